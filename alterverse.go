@@ -13,15 +13,111 @@ import (
 
 const alterverseFile = ".alterverse.yml"
 
+const (
+	// linksSubstitute substitutes the values of the manifest in the targets
+	// of symbolic links.
+	linksSubstitute = "substitute"
+	// linksKeep leaves the targets of symbolic links untouched.
+	linksKeep = "keep"
+)
+
 // Manifest contains a map of identifiers to thir values.
 type Manifest map[string]string
 
+// UnmarshalYAML implements the yaml.Unmarshaler interface. Nested maps and
+// lists are flattened into dotted key names, eg. 'db.primary.host' or
+// 'hosts.0'.
+func (m *Manifest) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw map[string]manifestNode
+	err := unmarshal(&raw)
+	if err != nil {
+		return err
+	}
+
+	out := Manifest{}
+	for k, node := range raw {
+		err := node.flatten(k, out)
+		if err != nil {
+			return err
+		}
+	}
+	*m = out
+	return nil
+}
+
+// manifestNode is a node of a nested manifest. It either holds a value, a map
+// of children or a list of children.
+type manifestNode struct {
+	value    *string
+	children map[string]manifestNode
+	list     []manifestNode
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (n *manifestNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		n.value = &value
+		return nil
+	}
+	if err := unmarshal(&n.children); err == nil {
+		return nil
+	}
+	return unmarshal(&n.list)
+}
+
+// flatten adds the node and all its children to the manifest passed using the
+// key passed as prefix.
+func (n manifestNode) flatten(key string, m Manifest) error {
+	switch {
+	case n.children != nil:
+		for k, child := range n.children {
+			err := child.flatten(key+"."+k, m)
+			if err != nil {
+				return err
+			}
+		}
+	case n.list != nil:
+		for i, child := range n.list {
+			err := child.flatten(fmt.Sprintf("%s.%d", key, i), m)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		if _, ok := m[key]; ok {
+			return fmt.Errorf("key '%s' is defined more than once", key)
+		}
+		value := ""
+		if n.value != nil {
+			value = *n.value
+		}
+		m[key] = value
+	}
+	return nil
+}
+
 // Alterverse contains specific information per alterverse.
 type Alterverse struct {
 	Manifest Manifest `json:"manifest" yaml:"manifest"`
+	Extends  string   `json:"extends,omitempty" yaml:"extends,omitempty"`
+	Include  []string `json:"include,omitempty" yaml:"include,omitempty"`
+	Options  Options  `json:"options,omitempty" yaml:"options,omitempty"`
+	// Links configures if the targets of symbolic links are substituted
+	// ('substitute', the default) or kept as they are ('keep').
+	Links string `json:"links,omitempty" yaml:"links,omitempty"`
+	// Binary configures how binary files are handled, see BinaryRule. Binary
+	// files not matching any rule are copied verbatim.
+	Binary []BinaryRule `json:"binary,omitempty" yaml:"binary,omitempty"`
 
 	location string
 	syncer   *Syncer
+	// origins maps the keys of the manifest to the manifest file that
+	// defined the value.
+	origins map[string]string
+	// subtrees holds the alterverses of the directories which have their own
+	// manifest file, see readSubtrees.
+	subtrees map[string]*Alterverse
 }
 
 // NewAlterverse takes a path to a dicectory, reads the manifest file,
@@ -31,24 +127,30 @@ func NewAlterverse(location, ignore string) (*Alterverse, []error) {
 
 	li, err := os.Stat(location)
 	if err != nil {
-		err = fmt.Errorf("error while checking location '%s': %s", location, err)
-		return a, []error{err}
+		return a, []error{newError(CodeInvalidLocation, "error while checking location '%s': %s", location, err)}
 	}
 	if !li.IsDir() {
-		err = fmt.Errorf("location '%s' does not seem to be a directory", location)
-		return a, []error{err}
+		return a, []error{newError(CodeInvalidLocation, "location '%s' does not seem to be a directory", location)}
 	}
 
 	manifestPath := filepath.Join(location, alterverseFile)
-	manifestFile, err := ioutil.ReadFile(manifestPath)
+	err = readManifestFile(manifestPath, a, nil)
 	if err != nil {
-		err = fmt.Errorf("error while reading manifest file '%s': %s", manifestPath, err)
 		return a, []error{err}
 	}
-	err = yaml.Unmarshal(manifestFile, a)
+
+	if a.Links != "" && a.Links != linksSubstitute && a.Links != linksKeep {
+		return a, []error{newError(CodeInvalidManifest, "links must be '%s' or '%s' but is '%s'", linksSubstitute, linksKeep, a.Links).inFile(manifestPath)}
+	}
+
+	err = a.compileBinaryRules()
 	if err != nil {
-		err = fmt.Errorf("error while unmarshalling manifest file '%s': %s", manifestPath, err)
-		return a, []error{err}
+		return a, []error{asError(err).inFile(manifestPath)}
+	}
+
+	errs := a.HasUndefinedValues()
+	if len(errs) > 0 {
+		return a, errs
 	}
 
 	a.syncer, err = NewSyncer(location, ignore)
@@ -56,22 +158,147 @@ func NewAlterverse(location, ignore string) (*Alterverse, []error) {
 		return a, []error{err}
 	}
 
-	errs := a.HasValueDublicates()
+	errs = a.HasValueDublicates()
+	if len(errs) > 0 {
+		return a, errs
+	}
+
+	a.subtrees, errs = a.readSubtrees()
 	return a, errs
 }
 
+// readManifestFile reads the manifest file passed into the alterverse passed and
+// merges the manifest with the manifest files it extends and includes. The
+// manifest extended is overridden by the manifests included which are overridden
+// by the manifest itself. The stack holds the manifest files which are currently
+// being read and is used to detect cycles.
+func readManifestFile(path string, a *Alterverse, stack []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for i, p := range stack {
+		if p == abs {
+			return newError(CodeManifestCycle, "manifest files include each other: %s", strings.Join(append(stack[i:], abs), " -> ")).inFile(path)
+		}
+	}
+	stack = append(stack, abs)
+
+	manifestFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return newError(CodeInvalidManifest, "error while reading manifest file '%s': %s", path, err).inFile(path)
+	}
+	err = yaml.Unmarshal(manifestFile, a)
+	if err != nil {
+		return newError(CodeInvalidManifest, "error while unmarshalling manifest file '%s': %s", path, err).inFile(path)
+	}
+
+	parents := []string{}
+	if a.Extends != "" {
+		parents = append(parents, a.Extends)
+	}
+	parents = append(parents, a.Include...)
+
+	merged := Manifest{}
+	mergedOptions := Options{}
+	origins := map[string]string{}
+	for _, parent := range parents {
+		if !filepath.IsAbs(parent) {
+			parent = filepath.Join(filepath.Dir(path), parent)
+		}
+		p := &Alterverse{}
+		err := readManifestFile(parent, p, stack)
+		if err != nil {
+			return err
+		}
+		for k, v := range p.Manifest {
+			merged[k] = v
+			origins[k] = p.origins[k]
+		}
+		for k, o := range p.Options {
+			mergedOptions[k] = o
+		}
+	}
+	for k, v := range a.Manifest {
+		merged[k] = v
+		origins[k] = path
+	}
+	for k, o := range a.Options {
+		mergedOptions[k] = o
+	}
+
+	a.Manifest, a.Options, a.origins = merged, mergedOptions, origins
+	return nil
+}
+
+// HasUndefinedValues checks if any key of the manifest has an empty value. This
+// is the case if a manifest extended or included declares a key without a value
+// and the value is never defined.
+func (a Alterverse) HasUndefinedValues() []error {
+	keys := make([]string, 0, len(a.Manifest))
+	for k := range a.Manifest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	errs := []error{}
+	for _, k := range keys {
+		if a.Manifest[k] == "" {
+			errs = append(errs, newError(CodeUndefinedValue, "key '%s' declared in '%s' has no value in the manifest of '%s'", k, a.origins[k], a.location).inFile(a.origins[k]).forKey(k))
+		}
+	}
+	return errs
+}
+
+// MissingKeys checks if all keys of the manifest are also present in the
+// manifest of the alterverse passed.
+func (a Alterverse) MissingKeys(other *Alterverse) []error {
+	keys := make([]string, 0, len(a.Manifest))
+	for k := range a.Manifest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	errs := []error{}
+	for _, k := range keys {
+		if _, ok := other.Manifest[k]; !ok {
+			errs = append(errs, newError(CodeMissingKey, "key '%s' defined in '%s' is missing in the manifest of '%s'", k, a.origins[k], other.location).inFile(a.origins[k]).forKey(k))
+		}
+	}
+	return errs
+}
+
 // Files reads all files related to the alterverse and returns them as a map where the keys are
 // the relative file names and the values are the bytes.
 func (a Alterverse) Files() (map[string][]byte, error) {
 	return a.syncer.ReadFiles()
 }
 
+// Meta returns the metadata of all files related to the alterverse, the keys are the relative
+// file names.
+func (a Alterverse) Meta() (map[string]FileMeta, error) {
+	return a.syncer.ReadMeta()
+}
+
+// WriteMeta applies the metadata passed to the files of the alterverse, see Syncer.writeMeta.
+func (a Alterverse) WriteMeta(meta map[string]FileMeta, modTimes bool) error {
+	return a.syncer.writeMeta(meta, modTimes)
+}
+
 // WriteFiles writes the files passed to the base directory of the alterverse. File names must
 // be relative to the alterverse. Files that exist on the file system but not in the map passed
-// will be deleted.
-func (a Alterverse) WriteFiles(files map[string][]byte) error {
+// will be deleted. Files marked as symbolic link in the metadata passed are written as links.
+func (a Alterverse) WriteFiles(files map[string][]byte, meta map[string]FileMeta) error {
 	deleteObselete := true
-	return a.syncer.WriteFiles(files, deleteObselete)
+	return a.syncer.writeFilesWithMeta(files, meta, deleteObselete)
+}
+
+// UpdateFiles writes the files passed to the base directory of the alterverse and
+// deletes the files listed in del. File names must be relative to the alterverse.
+// Other files are left untouched. Files marked as symbolic link in the metadata passed
+// are written as links.
+func (a Alterverse) UpdateFiles(files, del map[string][]byte, meta map[string]FileMeta) error {
+	return a.syncer.updateFiles(files, meta, del)
 }
 
 // HasValueDublicates checks some definitions have equal values strings. If this is true it is
@@ -82,7 +309,7 @@ func (a Alterverse) HasValueDublicates() []error {
 	reverse := reverseStringMap(a.Manifest)
 	for v, k := range reverse {
 		if len(k) > 1 {
-			errs = append(errs, fmt.Errorf("the keys '%s' have the same value '%s'", strings.Join(k, ", "), v))
+			errs = append(errs, newError(CodeDuplicateValue, "the keys '%s' have the same value '%s'", strings.Join(k, ", "), v).forKey(k[0]))
 		}
 	}
 
@@ -2,8 +2,13 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"gopkg.in/yaml.v2"
 )
 
 func TestNewAlterverse(t *testing.T) {
@@ -19,6 +24,10 @@ func TestNewAlterverse(t *testing.T) {
 		{location: "alterverse_manifest_missing", ignore: defaultIgnore, errExpected: true},
 		{location: "alterverse_is_file", ignore: defaultIgnore, errExpected: true},
 		{location: "alterverse_malformed_manifest", ignore: defaultIgnore, errExpected: true},
+		{location: "alterverse_extends", ignore: defaultIgnore, errExpected: false},
+		{location: "alterverse_cycle", ignore: defaultIgnore, errExpected: true},
+		{location: "alterverse_undefined", ignore: defaultIgnore, errExpected: true},
+		{location: "subtree_source", ignore: defaultIgnore, errExpected: false},
 	}
 
 	for _, test := range tests {
@@ -34,6 +43,171 @@ func TestNewAlterverse(t *testing.T) {
 	}
 }
 
+func TestManifestInheritance(t *testing.T) {
+	t.Parallel()
+	expected := Manifest{
+		"account": "123456789012",
+		"region":  "eu-central-1",
+		"env":     "production",
+	}
+
+	a, errs := NewAlterverse(filepath.Join(testdata, "alterverse_extends"), defaultIgnore)
+	if len(errs) > 0 {
+		t.Fatalf("has unexpected errors, errors are: %v", errs)
+	}
+	if !reflect.DeepEqual(a.Manifest, expected) {
+		t.Errorf("merged manifest is not as expected: is %v, expected %v", a.Manifest, expected)
+	}
+
+	other := &Alterverse{Manifest: Manifest{"env": "test"}, location: "other"}
+	if errs := a.MissingKeys(other); len(errs) != 2 {
+		t.Errorf("expected 2 missing keys, errors are: %v", errs)
+	}
+}
+
+func TestSubtreeManifests(t *testing.T) {
+	t.Parallel()
+	expected := Manifest{
+		"account": "222222222222",
+		"env":     "production",
+	}
+
+	a, errs := NewAlterverse(filepath.Join(testdata, "subtree_source"), defaultIgnore)
+	if len(errs) > 0 {
+		t.Fatalf("has unexpected errors, errors are: %v", errs)
+	}
+	s, ok := a.subtrees["services/billing"]
+	if !ok {
+		t.Fatalf("subtree 'services/billing' not found, subtrees are: %v", a.subtrees)
+	}
+	if !reflect.DeepEqual(s.Manifest, expected) {
+		t.Errorf("merged manifest is not as expected: is %v, expected %v", s.Manifest, expected)
+	}
+	if a.subtree("services/billing/lambda", a.subtrees) != s {
+		t.Errorf("nested directory should belong to subtree 'services/billing'")
+	}
+	if a.subtree("services", a.subtrees) != a {
+		t.Errorf("parent directory should belong to the root")
+	}
+
+	files, err := a.Files()
+	if err != nil {
+		t.Fatalf("could not read files, error was: %s", err.Error())
+	}
+	if _, ok := files["services/billing/"+alterverseFile]; ok {
+		t.Errorf("manifest of subtree should not be synced")
+	}
+}
+
+func TestSubtreeManifestsIgnored(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		ignore   string
+		files    map[string]string
+		subtrees []string
+	}{
+		"NotIgnored": {
+			ignore:   defaultIgnore,
+			files:    map[string]string{"vendor/x/" + alterverseFile: "manifest:\n  extra: x\n"},
+			subtrees: []string{"vendor/x"},
+		},
+		"IgnoreFile": {
+			ignore:   defaultIgnore,
+			files:    map[string]string{".gitignore": "vendor/\n", "vendor/x/" + alterverseFile: "manifest:\n  extra: x\n"},
+			subtrees: []string{},
+		},
+		"IgnoreRegexp": {
+			ignore:   "^vendor/",
+			files:    map[string]string{"vendor/x/" + alterverseFile: "manifest:\n  extra: x\n"},
+			subtrees: []string{},
+		},
+		"GithubDirectory": {
+			ignore:   defaultIgnore,
+			files:    map[string]string{".github/x/" + alterverseFile: "manifest:\n  extra: x\n"},
+			subtrees: []string{".github/x"},
+		},
+		"HiddenDirectory": {
+			ignore:   defaultIgnore,
+			files:    map[string]string{".cache/x/" + alterverseFile: "manifest:\n  extra: x\n"},
+			subtrees: []string{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "omniverse")
+			if err != nil {
+				t.Fatalf("could not create temporary directory, error was: %s", err.Error())
+			}
+			defer os.RemoveAll(dir)
+			files := copyFiles(test.files)
+			files[alterverseFile] = "manifest:\n  env: production\n"
+			for name, data := range files {
+				path := filepath.Join(dir, name)
+				err := os.MkdirAll(filepath.Dir(path), 0755)
+				if err == nil {
+					err = ioutil.WriteFile(path, []byte(data), 0644)
+				}
+				if err != nil {
+					t.Fatalf("could not write file '%s', error was: %s", name, err.Error())
+				}
+			}
+
+			a, errs := NewAlterverse(dir, test.ignore)
+			if len(errs) > 0 {
+				t.Fatalf("has unexpected errors, errors are: %v", errs)
+			}
+			subtrees := []string{}
+			for dir := range a.subtrees {
+				subtrees = append(subtrees, dir)
+			}
+			if !reflect.DeepEqual(subtrees, test.subtrees) {
+				t.Errorf("subtrees are not as expected: is %v, expected %v", subtrees, test.subtrees)
+			}
+		})
+	}
+}
+
+func TestManifestUnmarshal(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		data        string
+		expected    Manifest
+		errExpected bool
+	}{
+		"Flat": {
+			data:     "manifest:\n  env: production\n  account: 123456789012\n",
+			expected: Manifest{"env": "production", "account": "123456789012"},
+		},
+		"Nested": {
+			data:     "manifest:\n  db:\n    primary:\n      host: db1.example.com\n    replica:\n      host: db2.example.com\n  version: 1.10\n",
+			expected: Manifest{"db.primary.host": "db1.example.com", "db.replica.host": "db2.example.com", "version": "1.10"},
+		},
+		"List": {
+			data:     "manifest:\n  hosts:\n    - a.example.com\n    - b.example.com\n",
+			expected: Manifest{"hosts.0": "a.example.com", "hosts.1": "b.example.com"},
+		},
+		"Duplicate": {
+			data:        "manifest:\n  db.host: a\n  db:\n    host: b\n",
+			errExpected: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := Alterverse{}
+			err := yaml.Unmarshal([]byte(test.data), &a)
+			if err != nil && !test.errExpected {
+				t.Errorf("has unexpected error, error is: %s", err.Error())
+			} else if err == nil && test.errExpected {
+				t.Errorf("error expected but no error occurred")
+			} else if err == nil && !reflect.DeepEqual(a.Manifest, test.expected) {
+				t.Errorf("manifest is not as expected: is %v, expected %v", a.Manifest, test.expected)
+			}
+		})
+	}
+}
+
 func TestValueDublicates(t *testing.T) {
 	t.Parallel()
 	tests := map[string]struct {
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	// binaryCopy copies the content of a file verbatim, only its path is
+	// deduced.
+	binaryCopy = "copy"
+	// binarySkip neither deduces a file nor touches it in the destination.
+	binarySkip = "skip"
+	// binarySubstitute substitutes the content of a file like any text file.
+	binarySubstitute = "substitute"
+)
+
+// binarySniffLen is the number of bytes inspected to detect binary content.
+const binarySniffLen = 8000
+
+// BinaryRule configures how the files matching the glob pattern are handled,
+// see compileGlob for the syntax of the pattern. The policy is one of 'copy',
+// 'skip' and 'substitute'.
+type BinaryRule struct {
+	Pattern string `json:"pattern" yaml:"pattern"`
+	Policy  string `json:"policy" yaml:"policy"`
+
+	re *regexp.Regexp
+}
+
+// compileBinaryRules validates the binary rules of the alterverse and compiles
+// their patterns.
+func (a *Alterverse) compileBinaryRules() error {
+	for i, rule := range a.Binary {
+		if rule.Policy != binaryCopy && rule.Policy != binarySkip && rule.Policy != binarySubstitute {
+			return newError(CodeInvalidManifest, "policy of binary pattern '%s' must be '%s', '%s' or '%s' but is '%s'", rule.Pattern, binaryCopy, binarySkip, binarySubstitute, rule.Policy)
+		}
+		re, err := compileGlob(rule.Pattern)
+		if err != nil {
+			return newError(CodeInvalidManifest, "binary pattern '%s' could not be compiled: %s", rule.Pattern, err.Error())
+		}
+		a.Binary[i].re = re
+	}
+	return nil
+}
+
+// binaryPolicy returns how the file passed is handled. Files matching a binary
+// rule get the policy of the first rule matching, other files with binary
+// content are copied verbatim. For text files not matching any rule an empty
+// string is returned.
+func (a Alterverse) binaryPolicy(name string, data []byte) string {
+	for _, rule := range a.Binary {
+		if rule.re != nil && rule.re.MatchString(name) {
+			return rule.Policy
+		}
+	}
+	if isBinary(data) {
+		return binaryCopy
+	}
+	return ""
+}
+
+// isBinary returns true if the data passed is not text. Data containing NUL
+// bytes and data sniffed as arbitrary binary data is considered binary. As the
+// signatures of other content types may be the start of a text file as well,
+// eg. 'BM' of bitmaps, data sniffed as such only counts as binary if it
+// contains control characters, like the signatures of images and archives do.
+// Text in encodings other than UTF-8, eg. Latin-1, is not binary.
+func isBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+	contentType := http.DetectContentType(data)
+	if contentType == "application/octet-stream" {
+		return true
+	}
+	return !strings.HasPrefix(contentType, "text/") && hasControlBytes(data)
+}
+
+// hasControlBytes returns true if the data passed contains control characters
+// which do not appear in text, see the binary data bytes of the MIME sniffing
+// standard.
+func hasControlBytes(data []byte) bool {
+	for _, b := range data {
+		if b <= 0x08 || b == 0x0b || (b >= 0x0e && b <= 0x1a) || (b >= 0x1c && b <= 0x1f) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeBinaryPolicy returns a short description of the policy passed for
+// the diff output.
+func describeBinaryPolicy(policy string) string {
+	switch policy {
+	case binaryCopy:
+		return "copied verbatim"
+	case binarySkip:
+		return "skipped"
+	default:
+		return "substituted"
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIsBinary(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		data           []byte
+		binaryExpected bool
+	}{
+		"Empty":    {data: []byte{}, binaryExpected: false},
+		"Text":     {data: []byte("env=production\n"), binaryExpected: false},
+		"JSON":     {data: []byte(`{"env": "production"}`), binaryExpected: false},
+		"NulByte":  {data: []byte("env=production\x00"), binaryExpected: true},
+		"PNG":      {data: []byte("\x89PNG\r\n\x1a\nproduction"), binaryExpected: true},
+		"Gzip":     {data: []byte("\x1f\x8b\x08production"), binaryExpected: true},
+		"UTF8Text": {data: []byte("Umgebung: Produktion – äöü"), binaryExpected: false},
+		"BMPLike":  {data: []byte("BMW_REGION=prod\n"), binaryExpected: false},
+		"ID3Like":  {data: []byte("ID3 tags are read from the header\n"), binaryExpected: false},
+		"GIFLike":  {data: []byte("GIF89a is the format of the logo\n"), binaryExpected: false},
+		"PSLike":   {data: []byte("%!PS-Adobe-3.0\n%%Title: production\n"), binaryExpected: false},
+		"Latin1":   {data: []byte("env=production caf\xe9\n"), binaryExpected: false},
+		"Control":  {data: []byte("env=production\x01\x02"), binaryExpected: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if isBinary(test.data) != test.binaryExpected {
+				t.Errorf("binary detection should be %t", test.binaryExpected)
+			}
+		})
+	}
+}
+
+func TestNewDeductionBinary(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		rules       string
+		source      map[string]string
+		destination map[string]string
+		deduced     map[string][]byte
+		binary      map[string]string
+		errExpected bool
+	}{
+		"DetectedBinaryIsCopied": {
+			source:  map[string]string{"production.png": "\x89PNG\r\n\x1a\nproduction", "a": "env=production"},
+			deduced: map[string][]byte{"test.png": []byte("\x89PNG\r\n\x1a\nproduction"), "a": []byte("env=test")},
+			binary:  map[string]string{"test.png": binaryCopy},
+		},
+		"Latin1IsSubstituted": {
+			source:  map[string]string{"a": "env=production caf\xe9\n"},
+			deduced: map[string][]byte{"a": []byte("env=test caf\xe9\n")},
+			binary:  map[string]string{},
+		},
+		"SubstituteRule": {
+			rules:   "binary:\n  - pattern: '**/*.dat'\n    policy: substitute\n",
+			source:  map[string]string{"data/production.dat": "production\x00"},
+			deduced: map[string][]byte{"data/test.dat": []byte("test\x00")},
+			binary:  map[string]string{"data/test.dat": binarySubstitute},
+		},
+		"SkipRule": {
+			rules:       "binary:\n  - pattern: 'assets/**'\n    policy: skip\n",
+			source:      map[string]string{"assets/logo.png": "\x89PNG\r\n\x1a\nproduction", "a": "env=production"},
+			destination: map[string]string{"assets/logo.png": "\x89PNG\r\n\x1a\nlocal", "assets/other.png": "other"},
+			deduced:     map[string][]byte{"assets/logo.png": []byte("\x89PNG\r\n\x1a\nlocal"), "assets/other.png": []byte("other"), "a": []byte("env=test")},
+			binary:      map[string]string{"assets/logo.png": binarySkip, "assets/other.png": binarySkip},
+		},
+		"FirstRuleWins": {
+			rules:   "binary:\n  - pattern: '*.txt'\n    policy: copy\n  - pattern: '**'\n    policy: substitute\n",
+			source:  map[string]string{"a.txt": "production", "b": "production"},
+			deduced: map[string][]byte{"a.txt": []byte("production"), "b": []byte("test")},
+			binary:  map[string]string{"a.txt": binaryCopy, "b": binarySubstitute},
+		},
+		"InvalidPolicy": {
+			rules:       "binary:\n  - pattern: '*.png'\n    policy: ignore\n",
+			source:      map[string]string{},
+			errExpected: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dirs := map[string]string{}
+			for env, files := range map[string]map[string]string{"production": test.source, "test": test.destination} {
+				dir, err := ioutil.TempDir("", "omniverse")
+				if err != nil {
+					t.Fatalf("could not create temporary directory, error was: %s", err.Error())
+				}
+				defer os.RemoveAll(dir)
+				files = copyFiles(files)
+				files[alterverseFile] = "manifest:\n  env: " + env + "\n" + test.rules
+				for name, data := range files {
+					path := filepath.Join(dir, name)
+					err := os.MkdirAll(filepath.Dir(path), 0755)
+					if err == nil {
+						err = ioutil.WriteFile(path, []byte(data), 0644)
+					}
+					if err != nil {
+						t.Fatalf("could not write file '%s', error was: %s", name, err.Error())
+					}
+				}
+				dirs[env] = dir
+			}
+
+			from, errs := NewAlterverse(dirs["production"], defaultIgnore)
+			if hasErrs(errs...) && !test.errExpected {
+				t.Fatalf("has unexpected errors, errors are: %v", errs)
+			} else if !hasErrs(errs...) && test.errExpected {
+				t.Fatalf("errors expected but no errors occurred")
+			}
+			if test.errExpected {
+				return
+			}
+			to, errs := NewAlterverse(dirs["test"], defaultIgnore)
+			if len(errs) > 0 {
+				t.Fatalf("could not create alterverse, errors were: %v", errs)
+			}
+			files, err := from.Files()
+			if err != nil {
+				t.Fatalf("could not read files, error was: %s", err.Error())
+			}
+			d, errs := NewDeduction(from, files, to)
+			if len(errs) > 0 {
+				t.Fatalf("could not create deduction, errors were: %v", errs)
+			}
+			if !reflect.DeepEqual(d.Deduced, test.deduced) {
+				t.Errorf("deduced files are not as expected: is %q, expected %q", d.Deduced, test.deduced)
+			}
+			if !reflect.DeepEqual(d.Binary, test.binary) {
+				t.Errorf("binary policies are not as expected: is %v, expected %v", d.Binary, test.binary)
+			}
+		})
+	}
+}
+
+func copyFiles(in map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
@@ -1,26 +1,76 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"regexp"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
 
-const defaultIgnore = `^.*[\\/]\..*|^\..*`
+// defaultIgnore matches all hidden files and directories (starting with a
+// '.') except the '.github' directory, which holds workflows that are deduced
+// like any other file. RE2 lacks lookaheads, thus '.github' is excluded by
+// spelling out every component starting with a prefix of it.
+const defaultIgnore = `(^|[\\/])\.([^g]|g($|[^i])|gi($|[^t])|git($|[^h])|gith($|[^u])|githu($|[^b])|github($|[^\\/]))`
+
+const (
+	outputText  = "text"
+	outputPatch = "patch"
+	outputJSON  = "json"
+)
 
 type App struct {
 	// config
 	cfg struct {
-		deduceFrom     string
-		deduceTo       string
-		deduceIgnore   string
-		deduceDryRun   bool
-		deduceSilent   bool
-		contextsIn     string
-		contextsIgnore string
+		deduceFrom       string
+		deduceTo         string
+		deduceIgnore     string
+		deduceSrcIgnore  string
+		deduceDstIgnore  string
+		deduceDryRun     bool
+		deduceSilent     bool
+		deduceMerge      bool
+		deduceMarkers    bool
+		deduceAll        bool
+		deduceProject    string
+		deduceOutput     string
+		deduceStats      bool
+		deduceMtimes     bool
+		checkFrom        string
+		checkTo          string
+		checkIgnore      string
+		checkSrcIgnore   string
+		checkDstIgnore   string
+		checkOutput      string
+		checkStats       bool
+		reverseFrom      string
+		reverseTo        string
+		reverseIgnore    string
+		reverseSrcIgnore string
+		reverseDstIgnore string
+		reverseDryRun    bool
+		reverseSilent    bool
+		inferFrom        string
+		inferTo          string
+		inferIgnore      string
+		contextsIn       string
+		contextsIgnore   string
+		lintIn           string
+		lintTo           string
+		lintIgnore       string
+		lintMaxContexts  int
+		lintOutput       string
+		undoIn           string
+		undoIgnore       string
+		undoDryRun       bool
 	}
 
 	// entry point
@@ -41,17 +91,91 @@ func NewApp() *App {
 	deduceCmd := &cobra.Command{
 		Use:   "deduce",
 		Short: "Deduce an alterverse",
-		Run:   a.deduceCmd,
+		Long: `Deduces the destination alterverse from the source alterverse and writes the files.
+With --all every destination listed in the project file is deduced concurrently.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if !a.cfg.deduceAll && (a.cfg.deduceFrom == "" || a.cfg.deduceTo == "") {
+				return fmt.Errorf(`required flag(s) "from", "to" not set`)
+			}
+			return checkOutput(a.cfg.deduceOutput)
+		},
+		Run: a.deduceCmd,
 	}
-	deduceCmd.Flags().StringVarP(&a.cfg.deduceFrom, "from", "f", "", "source alterverse path")
-	deduceCmd.MarkFlagRequired("from")
-	deduceCmd.Flags().StringVarP(&a.cfg.deduceTo, "to", "t", "", "destination alterverse path")
-	deduceCmd.MarkFlagRequired("to")
-	deduceCmd.Flags().StringVar(&a.cfg.deduceIgnore, "ignore", defaultIgnore, "if a filename matches this regexp it is ignored - by default all hidden files and directories (starting with a '.') are ignored")
+	deduceCmd.Flags().StringVarP(&a.cfg.deduceFrom, "from", "f", "", "source alterverse path, required unless --all is set")
+	deduceCmd.Flags().StringVarP(&a.cfg.deduceTo, "to", "t", "", "destination alterverse path, required unless --all is set")
+	deduceCmd.Flags().BoolVar(&a.cfg.deduceAll, "all", false, "deduce all destinations listed in the project file")
+	deduceCmd.Flags().StringVar(&a.cfg.deduceProject, "project", projectFile, "project file path used with --all")
+	deduceCmd.Flags().StringVar(&a.cfg.deduceIgnore, "ignore", defaultIgnore, "if a filename matches this regexp it is ignored - by default all hidden files and directories (starting with a '.') except '.github' are ignored, an empty regexp ignores nothing - patterns in '.gitignore' and '.alterverseignore' files are respected in addition")
+	deduceCmd.Flags().StringVar(&a.cfg.deduceSrcIgnore, "source-ignore", "", "if a filename of the source matches this regexp it is ignored - defaults to the regexp passed with --ignore")
+	deduceCmd.Flags().StringVar(&a.cfg.deduceDstIgnore, "destination-ignore", "", "if a filename of the destination matches this regexp it is ignored, such files are neither written nor deleted - defaults to the regexp passed with --ignore")
 	deduceCmd.Flags().BoolVar(&a.cfg.deduceDryRun, "dry-run", false, "only in-memory, no write to filesystem")
 	deduceCmd.Flags().BoolVar(&a.cfg.deduceSilent, "silent", false, "mimimum output, no diff")
+	deduceCmd.Flags().BoolVar(&a.cfg.deduceMerge, "merge", false, "preserve changes made in destination since the last deduce using a three-way merge")
+	deduceCmd.Flags().BoolVar(&a.cfg.deduceMarkers, "conflict-markers", false, "write merge conflicts enclosed in conflict markers instead of failing")
+	deduceCmd.Flags().BoolVar(&a.cfg.deduceMtimes, "preserve-mtimes", false, "set the modification times of the files written to the ones of the source files")
+	deduceCmd.Flags().BoolVar(&a.cfg.deduceStats, "stats", false, "report where every manifest key has been substituted and which keys matched nothing")
+	deduceCmd.Flags().StringVarP(&a.cfg.deduceOutput, "output", "o", outputText, "output format, either 'text', 'patch' (a unified diff) or 'json' (a report)")
 	rootCmd.AddCommand(deduceCmd)
 
+	// check
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check if an alterverse is in sync with its source",
+		Long: `Deduces the destination alterverse in memory and compares the result with the files
+present in the destination. If any file would be changed, created, deleted or renamed
+a summary of the drift is printed and the command exits with a non-zero exit code.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			return checkOutput(a.cfg.checkOutput)
+		},
+		Run: a.checkCmd,
+	}
+	checkCmd.Flags().StringVarP(&a.cfg.checkFrom, "from", "f", "", "source alterverse path")
+	checkCmd.MarkFlagRequired("from")
+	checkCmd.Flags().StringVarP(&a.cfg.checkTo, "to", "t", "", "destination alterverse path")
+	checkCmd.MarkFlagRequired("to")
+	checkCmd.Flags().StringVar(&a.cfg.checkIgnore, "ignore", defaultIgnore, "if a filename matches this regexp it is ignored - by default all hidden files and directories (starting with a '.') except '.github' are ignored, an empty regexp ignores nothing - patterns in '.gitignore' and '.alterverseignore' files are respected in addition")
+	checkCmd.Flags().StringVar(&a.cfg.checkSrcIgnore, "source-ignore", "", "if a filename of the source matches this regexp it is ignored - defaults to the regexp passed with --ignore")
+	checkCmd.Flags().StringVar(&a.cfg.checkDstIgnore, "destination-ignore", "", "if a filename of the destination matches this regexp it is ignored, such files are neither written nor deleted - defaults to the regexp passed with --ignore")
+	checkCmd.Flags().BoolVar(&a.cfg.checkStats, "stats", false, "report where every manifest key has been substituted and which keys matched nothing")
+	checkCmd.Flags().StringVarP(&a.cfg.checkOutput, "output", "o", outputText, "output format, either 'text', 'patch' (a unified diff) or 'json' (a report)")
+	rootCmd.AddCommand(checkCmd)
+
+	// reverse
+	reverseCmd := &cobra.Command{
+		Use:   "reverse",
+		Short: "Propagate changes from an alterverse back to its source",
+		Long: `Finds all files that have been changed, created or deleted in the destination alterverse
+since the last deduce, maps them back using the manifests and applies them to the source
+alterverse. Files which cannot be mapped back unambiguously are refused.`,
+		Run: a.reverseCmd,
+	}
+	reverseCmd.Flags().StringVarP(&a.cfg.reverseFrom, "from", "f", "", "source alterverse path")
+	reverseCmd.MarkFlagRequired("from")
+	reverseCmd.Flags().StringVarP(&a.cfg.reverseTo, "to", "t", "", "destination alterverse path")
+	reverseCmd.MarkFlagRequired("to")
+	reverseCmd.Flags().StringVar(&a.cfg.reverseIgnore, "ignore", defaultIgnore, "if a filename matches this regexp it is ignored - by default all hidden files and directories (starting with a '.') except '.github' are ignored, an empty regexp ignores nothing - patterns in '.gitignore' and '.alterverseignore' files are respected in addition")
+	reverseCmd.Flags().StringVar(&a.cfg.reverseSrcIgnore, "source-ignore", "", "if a filename of the source matches this regexp it is ignored - defaults to the regexp passed with --ignore")
+	reverseCmd.Flags().StringVar(&a.cfg.reverseDstIgnore, "destination-ignore", "", "if a filename of the destination matches this regexp it is ignored, such files are neither written nor deleted - defaults to the regexp passed with --ignore")
+	reverseCmd.Flags().BoolVar(&a.cfg.reverseDryRun, "dry-run", false, "only in-memory, no write to filesystem")
+	reverseCmd.Flags().BoolVar(&a.cfg.reverseSilent, "silent", false, "mimimum output, no diff")
+	rootCmd.AddCommand(reverseCmd)
+
+	// infer
+	inferCmd := &cobra.Command{
+		Use:   "infer",
+		Short: "Propose manifests for two existing directories",
+		Long: `Compares the files of two directories which do not need to contain manifest files yet
+and proposes a manifest for each of them which allows to deduce the destination from the
+source. Files that cannot be explained by the manifests proposed are reported.`,
+		Run: a.inferCmd,
+	}
+	inferCmd.Flags().StringVarP(&a.cfg.inferFrom, "from", "f", "", "source directory path")
+	inferCmd.MarkFlagRequired("from")
+	inferCmd.Flags().StringVarP(&a.cfg.inferTo, "to", "t", "", "destination directory path")
+	inferCmd.MarkFlagRequired("to")
+	inferCmd.Flags().StringVar(&a.cfg.inferIgnore, "ignore", defaultIgnore, "if a filename matches this regexp it is ignored - by default all hidden files and directories (starting with a '.') except '.github' are ignored, an empty regexp ignores nothing - patterns in '.gitignore' and '.alterverseignore' files are respected in addition")
+	rootCmd.AddCommand(inferCmd)
+
 	// contexts
 	contextsCmd := &cobra.Command{
 		Use:   "contexts",
@@ -63,9 +187,48 @@ contexts you perhaps want to consider to have more manifest definitions which ar
 		Run:    a.contextsCmd,
 	}
 	contextsCmd.Flags().StringVar(&a.cfg.contextsIn, "in", ".", "alterverse path to check")
-	contextsCmd.Flags().StringVar(&a.cfg.contextsIgnore, "ignore", defaultIgnore, "if a filename matches this regexp it is ignored - by default all hidden files and directories (starting with a '.') are ignored")
+	contextsCmd.Flags().StringVar(&a.cfg.contextsIgnore, "ignore", defaultIgnore, "if a filename matches this regexp it is ignored - by default all hidden files and directories (starting with a '.') except '.github' are ignored, an empty regexp ignores nothing - patterns in '.gitignore' and '.alterverseignore' files are respected in addition")
 	rootCmd.AddCommand(contextsCmd)
 
+	// lint
+	lintCmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check a manifest for values that are likely to cause wrong substitutions",
+		Long: `Checks the values of the manifest against the files of the alterverse and warns about
+values that appear in many distinct contexts, values that are part of other values or of
+words found in the files and keys that match nothing. If a destination is passed the files
+are deduced in memory and every error, eg. a destination value already present in the
+source, is reported as well. The command exits with a non-zero exit code if errors are found.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if a.cfg.lintOutput != outputText && a.cfg.lintOutput != outputJSON {
+				return fmt.Errorf("unknown output format '%s', available formats are: %s, %s", a.cfg.lintOutput, outputText, outputJSON)
+			}
+			return nil
+		},
+		Run: a.lintCmd,
+	}
+	lintCmd.Flags().StringVar(&a.cfg.lintIn, "in", ".", "alterverse path to check")
+	lintCmd.Flags().StringVarP(&a.cfg.lintTo, "to", "t", "", "destination alterverse path, optional")
+	lintCmd.Flags().StringVar(&a.cfg.lintIgnore, "ignore", defaultIgnore, "if a filename matches this regexp it is ignored - by default all hidden files and directories (starting with a '.') except '.github' are ignored, an empty regexp ignores nothing - patterns in '.gitignore' and '.alterverseignore' files are respected in addition")
+	lintCmd.Flags().IntVar(&a.cfg.lintMaxContexts, "max-contexts", 5, "warn about values appearing in more distinct contexts than this")
+	lintCmd.Flags().StringVarP(&a.cfg.lintOutput, "output", "o", outputText, "output format, either 'text' or 'json'")
+	rootCmd.AddCommand(lintCmd)
+
+	// undo
+	undoCmd := &cobra.Command{
+		Use:   "undo",
+		Short: "Restore an alterverse as it was before the last deduce",
+		Long: `Every deduce backs up the files of the destination alterverse before writing. Undo lists
+the changes it reverts and restores the files as well as the base of the next merge. Only
+the last deduce can be undone.`,
+		Run: a.undoCmd,
+	}
+	undoCmd.Flags().StringVarP(&a.cfg.undoIn, "in", "i", "", "alterverse path to restore")
+	undoCmd.MarkFlagRequired("in")
+	undoCmd.Flags().StringVar(&a.cfg.undoIgnore, "ignore", defaultIgnore, "if a filename matches this regexp it is ignored - by default all hidden files and directories (starting with a '.') except '.github' are ignored, an empty regexp ignores nothing - patterns in '.gitignore' and '.alterverseignore' files are respected in addition")
+	undoCmd.Flags().BoolVar(&a.cfg.undoDryRun, "dry-run", false, "only list the changes, no write to filesystem")
+	rootCmd.AddCommand(undoCmd)
+
 	// version
 	versionCmd := &cobra.Command{
 		Use:   "version",
@@ -78,50 +241,485 @@ contexts you perhaps want to consider to have more manifest definitions which ar
 }
 
 func (a *App) deduceCmd(cmd *cobra.Command, args []string) {
-	from, errs := NewAlterverse(a.cfg.deduceFrom, a.cfg.deduceIgnore)
-	exitOnErr(errs...)
-	fromFiles, err := from.Files()
-	exitOnErr(err)
+	if a.cfg.deduceAll {
+		var source, destination *string
+		if cmd.Flags().Changed("ignore") {
+			source, destination = &a.cfg.deduceIgnore, &a.cfg.deduceIgnore
+		}
+		if cmd.Flags().Changed("source-ignore") {
+			source = &a.cfg.deduceSrcIgnore
+		}
+		if cmd.Flags().Changed("destination-ignore") {
+			destination = &a.cfg.deduceDstIgnore
+		}
+		a.deduceProject(source, destination)
+		return
+	}
 
-	to, errs := NewAlterverse(a.cfg.deduceTo, a.cfg.deduceIgnore)
-	exitOnErr(errs...)
-	toFilesCurrent, err := to.Files()
-	exitOnErr(err)
+	resolveIgnores(cmd, a.cfg.deduceIgnore, &a.cfg.deduceSrcIgnore, &a.cfg.deduceDstIgnore)
+	if a.cfg.deduceOutput == outputJSON {
+		a.deduceReport()
+		return
+	}
+
+	d := a.deduce(a.cfg.deduceFrom, a.cfg.deduceTo, a.cfg.deduceSrcIgnore, a.cfg.deduceDstIgnore)
 
-	interverse, err := NewInterverse(from.Manifest, to.Manifest)
+	if a.cfg.deduceMerge {
+		errs := a.merge(d)
+		exitOnErr(errs...)
+	}
+
+	out := messages(a.cfg.deduceOutput)
+	if a.cfg.deduceOutput == outputPatch {
+		fmt.Print(d.Patch(""))
+	} else if !a.cfg.deduceSilent {
+		diffs, toDelete, toCreate, renamed := d.Diff()
+		printDiff(diffs, toDelete, toCreate, renamed, d.ModeChanges(), d.Binary, "destination")
+	}
+	if a.cfg.deduceStats {
+		printStats(out, d.Stats())
+	}
+
+	if !a.cfg.deduceDryRun {
+		fmt.Fprintln(out, "--- writing files")
+		err := a.write(d)
+		exitOnErr(err)
+	} else {
+		fmt.Fprintln(out, "--- dry-run NO files will be written")
+	}
+}
+
+// deduceReport deduces the destination and prints the report of the deduction
+// as JSON. Errors are part of the report, the program is exited with a
+// non-zero exit code if there are any.
+func (a *App) deduceReport() {
+	d, errs := newDeductionFromPaths(a.cfg.deduceFrom, a.cfg.deduceTo, a.cfg.deduceSrcIgnore, a.cfg.deduceDstIgnore)
+	if len(errs) == 0 && a.cfg.deduceMerge {
+		errs = a.merge(d)
+	}
+	r := NewReport(a.cfg.deduceFrom, a.cfg.deduceTo, d, errs)
+	if len(r.Errors) == 0 && a.cfg.deduceStats {
+		r.Keys = d.Stats()
+	}
+	if len(r.Errors) == 0 && !a.cfg.deduceDryRun {
+		a.writeReported(d, r)
+	}
+	printJSON(r)
+	if len(r.Errors) > 0 {
+		os.Exit(-1)
+	}
+}
+
+// write writes the deduction passed to its destination.
+func (a *App) write(d *Deduction) error {
+	d.PreserveModTimes = a.cfg.deduceMtimes
+	return d.Write()
+}
+
+// writeReported writes the deduction and records the outcome in the report
+// passed.
+func (a *App) writeReported(d *Deduction, r *Report) {
+	if err := a.write(d); err != nil {
+		r.Errors = append(r.Errors, asError(err))
+		return
+	}
+	r.Written = true
+}
+
+// deduceProject deduces all destinations of the project file and prints a
+// summary. Failing destinations do not affect the others, the program is
+// exited after all destinations have been processed.
+func (a *App) deduceProject(sourceIgnore, destinationIgnore *string) {
+	p, err := NewProject(a.cfg.deduceProject)
 	exitOnErr(err)
-	toFilesNew, errs := interverse.DeduceStrict(fromFiles)
+	deductions, errs := p.Deduce(sourceIgnore, destinationIgnore)
 	exitOnErr(errs...)
 
-	if !a.cfg.deduceSilent {
-		diffs, toDelete, toCreate := DiffFiles(toFilesCurrent, toFilesNew)
+	var summary bytes.Buffer
+	w := tabwriter.NewWriter(&summary, 0, 0, 1, ' ', tabwriter.Debug)
+	fmt.Fprintln(w, "destination\tchanged\tcreated\tdeleted\trenamed\tstatus")
+	failed := []error{}
+	out := messages(a.cfg.deduceOutput)
+	reports := []*Report{}
+	for _, pd := range deductions {
+		fmt.Fprintln(out, color.BlueString("=== destination '%s'", pd.Destination))
+		d := pd.Deduction
+		if len(pd.Errs) == 0 && a.cfg.deduceMerge {
+			pd.Errs = a.merge(d)
+		}
+		if a.cfg.deduceOutput == outputJSON {
+			r := NewReport(p.Source, pd.Destination, d, pd.Errs)
+			if len(r.Errors) == 0 && a.cfg.deduceStats {
+				r.Keys = d.Stats()
+			}
+			if len(r.Errors) == 0 && !a.cfg.deduceDryRun {
+				a.writeReported(d, r)
+			}
+			if len(r.Errors) > 0 {
+				failed = append(failed, fmt.Errorf("deducing '%s' failed", pd.Destination))
+			}
+			reports = append(reports, r)
+			continue
+		}
+		if len(pd.Errs) > 0 {
+			for _, err := range pd.Errs {
+				fmt.Fprintln(out, color.RedString("--- %s", err.Error()))
+			}
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\tfailed\n", pd.Destination)
+			failed = append(failed, fmt.Errorf("deducing '%s' failed", pd.Destination))
+			continue
+		}
 
-		for filename, diff := range diffs {
-			if diff == "" {
-				fmt.Println(color.YellowString("--- file '%s' is unchanged.", filename))
-			} else {
-				fmt.Printf(color.MagentaString("--- file '%s' has changes:\n", filename)+"%s", diff)
+		if a.cfg.deduceOutput == outputPatch {
+			fmt.Print(d.Patch(filepath.ToSlash(pd.Destination)))
+		} else if !a.cfg.deduceSilent {
+			diffs, toDelete, toCreate, renamed := d.Diff()
+			printDiff(diffs, toDelete, toCreate, renamed, d.ModeChanges(), d.Binary, "destination")
+		}
+		if a.cfg.deduceStats {
+			printStats(out, d.Stats())
+		}
+
+		status := "dry-run"
+		if !a.cfg.deduceDryRun {
+			status = "written"
+			if err := a.write(d); err != nil {
+				fmt.Fprintln(out, color.RedString("--- %s", err.Error()))
+				status = "failed"
+				failed = append(failed, fmt.Errorf("writing '%s' failed", pd.Destination))
 			}
 		}
+		changed, deleted, created, renamed := d.Drift()
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", pd.Destination, len(changed), len(created), len(deleted), len(renamed), status)
+	}
+	w.Flush()
 
-		for filename := range toDelete {
-			fmt.Println(color.RedString("--- file '%s' will be deleted in destination.", filename))
+	if a.cfg.deduceOutput == outputJSON {
+		printJSON(reports)
+		if len(failed) > 0 {
+			os.Exit(-1)
 		}
+		return
+	}
+	fmt.Fprintln(out, "--- summary")
+	fmt.Fprint(out, summary.String())
+	exitOnErr(failed...)
+}
+
+// merge performs a three-way merge on the deduction passed. Conflicts are
+// printed if conflict markers are enabled, otherwise they are returned as
+// errors.
+func (a *App) merge(d *Deduction) []error {
+	conflicts, err := d.Merge()
+	if err != nil {
+		return []error{err}
+	}
+	filenames := make([]string, 0, len(conflicts))
+	for filename := range conflicts {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
 
-		for filename := range toCreate {
-			fmt.Println(color.GreenString("--- file '%s' will be created in destination.", filename))
+	errs := []error{}
+	for _, filename := range filenames {
+		if a.cfg.deduceMarkers {
+			fmt.Fprintln(messages(a.cfg.deduceOutput), color.RedString("--- file '%s' has %d merge conflicts.", filename, conflicts[filename]))
+		} else {
+			errs = append(errs, newError(CodeMergeConflict, "file '%s' has %d merge conflicts", filename, conflicts[filename]).inFile(filename))
 		}
 	}
+	return errs
+}
 
-	if !a.cfg.deduceDryRun {
+func (a *App) reverseCmd(cmd *cobra.Command, args []string) {
+	resolveIgnores(cmd, a.cfg.reverseIgnore, &a.cfg.reverseSrcIgnore, &a.cfg.reverseDstIgnore)
+	d := a.deduce(a.cfg.reverseFrom, a.cfg.reverseTo, a.cfg.reverseSrcIgnore, a.cfg.reverseDstIgnore)
+
+	base, err := d.To.LastDeduced()
+	exitOnErr(err)
+	toWrite, toDelete, meta, errs := d.Reverse(base)
+	exitOnErr(errs...)
+
+	if len(toWrite)+len(toDelete) == 0 {
+		fmt.Println("--- no changes in destination, nothing to reverse")
+		return
+	}
+
+	if !a.cfg.reverseSilent {
+		current, err := d.From.Files()
+		exitOnErr(err)
+		touched := map[string][]byte{}
+		for filename := range toWrite {
+			if data, ok := current[filename]; ok {
+				touched[filename] = data
+			}
+		}
+		for filename := range toDelete {
+			touched[filename] = current[filename]
+		}
+		diffs, _, toCreate, _ := DiffFiles(touched, toWrite, nil)
+		printDiff(diffs, toDelete, toCreate, nil, nil, nil, "source")
+	}
+
+	if !a.cfg.reverseDryRun {
 		fmt.Println("--- writing files")
-		err = to.WriteFiles(toFilesNew)
+		err := d.From.UpdateFiles(toWrite, toDelete, meta)
+		exitOnErr(err)
+	} else {
+		fmt.Println("--- dry-run NO files will be written")
+	}
+}
+
+func (a *App) undoCmd(cmd *cobra.Command, args []string) {
+	in, errs := NewAlterverse(a.cfg.undoIn, a.cfg.undoIgnore)
+	exitOnErr(errs...)
+	backup, backupMeta, err := in.Backup()
+	exitOnErr(err)
+	if backup == nil {
+		exitOnErr(newError(CodeNoBackup, "there is no backup of '%s' to restore", a.cfg.undoIn))
+	}
+	current, err := in.Files()
+	exitOnErr(err)
+	currentMeta, err := in.Meta()
+	exitOnErr(err)
+
+	d := Deduction{Current: current, Deduced: backup, CurrentMeta: currentMeta, DeducedMeta: backupMeta}
+	diffs, toDelete, toCreate, _ := d.Diff()
+	modes := d.ModeChanges()
+	for filename, diff := range diffs {
+		if _, ok := modes[filename]; diff == "" && !ok {
+			delete(diffs, filename)
+		}
+	}
+	if len(diffs)+len(toDelete)+len(toCreate) == 0 {
+		fmt.Println("--- no changes since the last deduce, only the base of the next merge is restored")
+	}
+	printDiff(diffs, toDelete, toCreate, nil, modes, nil, "destination")
+
+	if !a.cfg.undoDryRun {
+		fmt.Println("--- restoring files")
+		err := in.Undo()
 		exitOnErr(err)
 	} else {
 		fmt.Println("--- dry-run NO files will be written")
 	}
 }
 
+func (a *App) checkCmd(cmd *cobra.Command, args []string) {
+	resolveIgnores(cmd, a.cfg.checkIgnore, &a.cfg.checkSrcIgnore, &a.cfg.checkDstIgnore)
+	if a.cfg.checkOutput == outputJSON {
+		d, errs := newDeductionFromPaths(a.cfg.checkFrom, a.cfg.checkTo, a.cfg.checkSrcIgnore, a.cfg.checkDstIgnore)
+		r := NewReport(a.cfg.checkFrom, a.cfg.checkTo, d, errs)
+		if len(r.Errors) == 0 && a.cfg.checkStats {
+			r.Keys = d.Stats()
+		}
+		printJSON(r)
+		if len(r.Errors) > 0 {
+			os.Exit(-1)
+		} else if !r.InSync {
+			os.Exit(1)
+		}
+		return
+	}
+
+	d := a.deduce(a.cfg.checkFrom, a.cfg.checkTo, a.cfg.checkSrcIgnore, a.cfg.checkDstIgnore)
+
+	changed, deleted, created, renamed := d.Drift()
+	if a.cfg.checkOutput == outputPatch {
+		fmt.Print(d.Patch(""))
+	} else {
+		for _, filename := range changed {
+			fmt.Println(color.MagentaString("--- file '%s' has drifted.", filename))
+		}
+		for _, filename := range deleted {
+			fmt.Println(color.RedString("--- file '%s' is not present in source.", filename))
+		}
+		for _, filename := range created {
+			fmt.Println(color.GreenString("--- file '%s' is missing in destination.", filename))
+		}
+		for _, filename := range renamed {
+			fmt.Println(color.CyanString("--- file '%s' is misnamed in destination.", filename))
+		}
+	}
+
+	if a.cfg.checkStats {
+		printStats(messages(a.cfg.checkOutput), d.Stats())
+	}
+
+	if d.InSync() {
+		fmt.Fprintln(messages(a.cfg.checkOutput), "--- destination is in sync with source")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "ERROR: destination has drifted: %d changed, %d deleted, %d created, %d renamed\n",
+		len(changed), len(deleted), len(created), len(renamed))
+	os.Exit(1)
+}
+
+// deduce reads the source and destination alterverses and deduces the
+// destination. The program is exited if any error occurs.
+func (a *App) deduce(fromPath, toPath, fromIgnore, toIgnore string) *Deduction {
+	d, errs := newDeductionFromPaths(fromPath, toPath, fromIgnore, toIgnore)
+	exitOnErr(errs...)
+	return d
+}
+
+// resolveIgnores sets the ignore regexps of the source and the destination
+// to the regexp passed with --ignore unless they are passed explicitly.
+func resolveIgnores(cmd *cobra.Command, ignore string, source, destination *string) {
+	if !cmd.Flags().Changed("source-ignore") {
+		*source = ignore
+	}
+	if !cmd.Flags().Changed("destination-ignore") {
+		*destination = ignore
+	}
+}
+
+// newDeductionFromPaths reads the source and destination alterverses and
+// deduces the destination.
+func newDeductionFromPaths(fromPath, toPath, fromIgnore, toIgnore string) (*Deduction, []error) {
+	from, errs := NewAlterverse(fromPath, fromIgnore)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	fromFiles, err := from.Files()
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	to, errs := NewAlterverse(toPath, toIgnore)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return NewDeduction(from, fromFiles, to)
+}
+
+// checkOutput validates the output format passed.
+func checkOutput(output string) error {
+	if output != outputText && output != outputPatch && output != outputJSON {
+		return fmt.Errorf("unknown output format '%s', available formats are: %s, %s, %s", output, outputText, outputPatch, outputJSON)
+	}
+	return nil
+}
+
+// printJSON prints the value passed as indented JSON.
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	exitOnErr(err)
+	fmt.Println(string(data))
+}
+
+// messages returns the writer progress messages are printed to. Unless the
+// output format is text they are printed to stderr so stdout only contains
+// the output itself.
+func messages(output string) io.Writer {
+	if output == outputText {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// printDiff prints the changes that will be applied to the location passed.
+func printDiff(diffs map[string]string, toDelete, toCreate map[string][]byte, renamed map[string]string, modes map[string]ModeChange, binary map[string]string, location string) {
+	for filename, diff := range diffs {
+		mode, modeChanged := modes[filename]
+		note := binaryNote(binary, filename)
+		if policy, ok := binary[filename]; ok && policy != binarySubstitute && diff != "" {
+			// the diff of binary content is not readable
+			diff = "Binary files differ\n"
+		}
+		if oldName, ok := renamed[filename]; ok {
+			fmt.Println(color.CyanString("--- file '%s' will be renamed to '%s' in %s%s.", oldName, filename, location, note))
+			if diff != "" {
+				fmt.Print(diff)
+			}
+		} else if diff == "" && !modeChanged {
+			fmt.Println(color.YellowString("--- file '%s' is unchanged%s.", filename, note))
+		} else if diff != "" {
+			fmt.Print(color.MagentaString("--- file '%s' has changes%s:\n", filename, note), diff)
+		}
+		if modeChanged {
+			fmt.Println(color.MagentaString("--- mode of file '%s' will be changed from %s.", filename, mode))
+		}
+	}
+
+	for filename := range toDelete {
+		fmt.Println(color.RedString("--- file '%s' will be deleted in %s.", filename, location))
+	}
+
+	for filename := range toCreate {
+		fmt.Println(color.GreenString("--- file '%s' will be created in %s%s.", filename, location, binaryNote(binary, filename)))
+	}
+}
+
+// binaryNote returns a note on the policy applied to the file passed if it is
+// binary, see Deduction.Binary.
+func binaryNote(binary map[string]string, filename string) string {
+	policy, ok := binary[filename]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" (binary, %s)", describeBinaryPolicy(policy))
+}
+
+// printStats prints where every manifest key has been substituted and flags
+// the keys which matched nothing.
+func printStats(w io.Writer, stats []KeyStats) {
+	for _, s := range stats {
+		if s.Unused {
+			fmt.Fprintln(w, color.YellowString("--- key '%s' matched nothing in source.", s.Key))
+			continue
+		}
+		fmt.Fprintln(w, color.BlueString("--- key '%s' matched %d times:", s.Key, s.Hits))
+		for _, p := range s.Placements {
+			if p.Path {
+				fmt.Fprintf(w, "    %s (path, column %d)\n", p.File, p.Column)
+			} else {
+				fmt.Fprintf(w, "    %s:%d:%d\n", p.File, p.Line, p.Column)
+			}
+		}
+	}
+}
+
+func (a *App) inferCmd(cmd *cobra.Command, args []string) {
+	fromSyncer, err := NewSyncer(a.cfg.inferFrom, a.cfg.inferIgnore)
+	exitOnErr(err)
+	fromFiles, err := fromSyncer.ReadFiles()
+	exitOnErr(err)
+
+	toSyncer, err := NewSyncer(a.cfg.inferTo, a.cfg.inferIgnore)
+	exitOnErr(err)
+	toFiles, err := toSyncer.ReadFiles()
+	exitOnErr(err)
+
+	fromManifest, toManifest, unexplained, errs := InferManifests(fromFiles, toFiles)
+
+	for _, location := range []struct {
+		path     string
+		manifest Manifest
+	}{
+		{path: a.cfg.inferFrom, manifest: fromManifest},
+		{path: a.cfg.inferTo, manifest: toManifest},
+	} {
+		d, err := yaml.Marshal(&Alterverse{Manifest: location.manifest})
+		exitOnErr(err)
+		fmt.Println(color.GreenString("--- proposed manifest for '%s':", filepath.Join(location.path, alterverseFile)))
+		fmt.Printf("%s\n", string(d))
+	}
+
+	names := make([]string, 0, len(unexplained))
+	for name := range unexplained {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(color.YellowString("--- file '%s' could not be explained: %s", name, unexplained[name]))
+	}
+	for _, err := range errs {
+		fmt.Println(color.RedString("--- %s", err.Error()))
+	}
+}
+
 func (a *App) contextsCmd(cmd *cobra.Command, args []string) {
 	in, errs := NewAlterverse(a.cfg.contextsIn, a.cfg.contextsIgnore)
 	exitOnErr(errs...)
@@ -129,31 +727,11 @@ func (a *App) contextsCmd(cmd *cobra.Command, args []string) {
 	exitOnErr(err)
 
 	contexts := map[string][]string{}
-	regexStart, regexEnd := `(\b[\w-_\.]*`, `[\w-_\.]*\b*)`
-	for _, data := range inData {
-		for key, value := range in.Manifest {
-			re, err := regexp.Compile(fmt.Sprintf("%s%s%s", regexStart, regexp.QuoteMeta(value), regexEnd))
-			exitOnErr(err)
-			matches := re.FindAll(data, -1)
-			for _, m := range matches {
-				context := string(m)
-				index := fmt.Sprintf("%s (%s)", key, value)
-				if _, ok := contexts[index]; !ok {
-					contexts[index] = []string{context}
-				} else {
-					found := false
-					for _, v := range contexts[index] {
-						if context == v {
-							found = true
-							break
-						}
-					}
-					if !found {
-						contexts[index] = append(contexts[index], context)
-					}
-				}
-			}
-
+	for key, value := range in.Manifest {
+		found, err := valueContexts(value, inData)
+		exitOnErr(err)
+		if len(found) > 0 {
+			contexts[fmt.Sprintf("%s (%s)", key, value)] = found
 		}
 	}
 	d, err := yaml.Marshal(&contexts)
@@ -161,6 +739,54 @@ func (a *App) contextsCmd(cmd *cobra.Command, args []string) {
 	fmt.Printf("--- \n%s\n\n", string(d))
 }
 
+func (a *App) lintCmd(cmd *cobra.Command, args []string) {
+	in, errs := NewAlterverse(a.cfg.lintIn, a.cfg.lintIgnore)
+	exitOnErr(errs...)
+	files, err := in.Files()
+	exitOnErr(err)
+	var to *Alterverse
+	if a.cfg.lintTo != "" {
+		to, errs = NewAlterverse(a.cfg.lintTo, a.cfg.lintIgnore)
+		exitOnErr(errs...)
+	}
+
+	findings, errs := Lint(in, files, to, a.cfg.lintMaxContexts)
+	exitOnErr(errs...)
+
+	failed := 0
+	if a.cfg.lintOutput == outputJSON {
+		printJSON(findings)
+	}
+	for _, f := range findings {
+		if f.Severity == severityError {
+			failed++
+		}
+		if a.cfg.lintOutput == outputJSON {
+			continue
+		}
+		location := ""
+		if f.File != "" && f.Line > 0 {
+			location = fmt.Sprintf(" (%s:%d:%d)", f.File, f.Line, f.Column)
+		} else if f.File != "" {
+			location = fmt.Sprintf(" (%s)", f.File)
+		}
+		line := fmt.Sprintf("--- %s [%s]: %s%s", f.Severity, f.Check, f.Message, location)
+		if f.Severity == severityError {
+			fmt.Println(color.RedString("%s", line))
+		} else {
+			fmt.Println(color.YellowString("%s", line))
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: lint found %d errors\n", failed)
+		os.Exit(1)
+	}
+	if a.cfg.lintOutput != outputJSON && len(findings) == 0 {
+		fmt.Println("--- no issues found")
+	}
+}
+
 func (a *App) versionCmd(cmd *cobra.Command, args []string) {
 	fmt.Println(versionInfo())
 }
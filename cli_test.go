@@ -24,6 +24,14 @@ func TestDefaultIgnore(t *testing.T) {
 		{filename: ".test", matchExpected: true},
 		{filename: `c:\\bsa\.sath`, matchExpected: true},
 		{filename: `aoeu\.tsaoe`, matchExpected: true},
+		{filename: ".github/workflows/ci.yml", matchExpected: false},
+		{filename: "foo/.github/workflows/ci.yml", matchExpected: false},
+		{filename: `foo\.github\workflows\ci.yml`, matchExpected: false},
+		{filename: ".gitignore", matchExpected: true},
+		{filename: ".g/test", matchExpected: true},
+		{filename: ".github", matchExpected: true},
+		{filename: ".githubx/test", matchExpected: true},
+		{filename: ".github/.test", matchExpected: true},
 	}
 
 	re := regexp.MustCompile(defaultIgnore)
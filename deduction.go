@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Deduction holds the result of deducing a destination alterverse from a
+// source alterverse. Nothing is written to the file system until Write is
+// called.
+type Deduction struct {
+	From *Alterverse
+	To   *Alterverse
+
+	// Current contains the files present in the destination alterverse.
+	Current map[string][]byte
+	// Deduced contains the files as they should be present in the
+	// destination alterverse.
+	Deduced map[string][]byte
+	// Renames maps the file paths of the source alterverse to the file paths
+	// in the destination alterverse.
+	Renames map[string]string
+	// Placements holds the location of every substitution within the source
+	// alterverse.
+	Placements []Placement
+	// CurrentMeta and DeducedMeta hold the metadata of the current and the
+	// deduced files. The metadata of the deduced files is copied from the
+	// source alterverse.
+	CurrentMeta map[string]FileMeta
+	DeducedMeta map[string]FileMeta
+	// Binary maps the deduced files which are binary or match a binary rule
+	// of the source alterverse to the policy applied, see BinaryRule.
+	Binary map[string]string
+	// PreserveModTimes configures if Write sets the modification times of
+	// the files written to the ones of the source files.
+	PreserveModTimes bool
+
+	interverse interverseTree
+	// baseline holds the deduced files without any changes of the destination
+	// merged in. It is recorded as the base of the next merge.
+	baseline map[string][]byte
+}
+
+// NewDeduction reads the destination alterverse and deduces the files of the
+// source alterverse passed.
+func NewDeduction(from *Alterverse, fromFiles map[string][]byte, to *Alterverse) (*Deduction, []error) {
+	d := &Deduction{From: from, To: to}
+
+	current, err := to.Files()
+	if err != nil {
+		return d, []error{err}
+	}
+	d.Current = current
+	d.CurrentMeta, err = to.Meta()
+	if err != nil {
+		return d, []error{err}
+	}
+	fromMeta, err := from.Meta()
+	if err != nil {
+		return d, []error{err}
+	}
+
+	interverse, errs := newInterverseTree(from, to)
+	if len(errs) > 0 {
+		return d, errs
+	}
+	d.interverse = interverse
+
+	// the content of files copied verbatim, binary files as well as the
+	// targets of symbolic links if configured, is left untouched, only their
+	// paths are deduced. Skipped files are not deduced at all.
+	substituted, verbatim, policies := map[string][]byte{}, map[string][]byte{}, map[string]string{}
+	for name, data := range fromFiles {
+		if fromMeta[name].IsSymlink() {
+			if from.Links == linksKeep {
+				verbatim[name], data = data, nil
+			}
+			substituted[name] = data
+			continue
+		}
+		policy := from.binaryPolicy(name, data)
+		if policy == binarySkip {
+			continue
+		} else if policy == binaryCopy {
+			verbatim[name], data = data, nil
+		}
+		if policy != "" {
+			policies[name] = policy
+		}
+		substituted[name] = data
+	}
+
+	d.Renames = interverse.DeducePaths(substituted)
+	d.DeducedMeta = map[string]FileMeta{}
+	for sourceName, name := range d.Renames {
+		if meta, ok := fromMeta[sourceName]; ok {
+			d.DeducedMeta[name] = meta
+		}
+	}
+
+	deduced, errs := interverse.DeduceStrict(substituted)
+	if len(errs) > 0 {
+		return d, errs
+	}
+	for sourceName, data := range verbatim {
+		deduced[d.Renames[sourceName]] = data
+	}
+	d.Placements = interverse.Placements(substituted)
+	d.Binary = map[string]string{}
+	for sourceName, policy := range policies {
+		d.Binary[d.Renames[sourceName]] = policy
+	}
+
+	// files of the destination which are skipped are left untouched
+	for name, data := range d.Current {
+		if _, ok := deduced[name]; ok || from.binaryPolicy(name, data) != binarySkip {
+			continue
+		}
+		deduced[name] = data
+		if meta, ok := d.CurrentMeta[name]; ok {
+			d.DeducedMeta[name] = meta
+		}
+		d.Binary[name] = binarySkip
+	}
+
+	errs = checkLinks(deduced, d.DeducedMeta)
+	if len(errs) > 0 {
+		return d, errs
+	}
+
+	deduced, errs = applyKeptRegions(d.Current, deduced, d.Renames)
+	if len(errs) > 0 {
+		return d, errs
+	}
+	d.Deduced = deduced
+	d.baseline = deduced
+
+	return d, nil
+}
+
+// checkLinks returns an error for every symbolic link among the files passed
+// whose target is absolute or lies outside the alterverse.
+func checkLinks(files map[string][]byte, meta map[string]FileMeta) []error {
+	errs := []error{}
+	for name, data := range files {
+		if !meta[name].IsSymlink() {
+			continue
+		}
+		target := string(data)
+		if filepath.IsAbs(target) {
+			errs = append(errs, newError(CodeLinkOutside, "link '%s' points to the absolute path '%s'", name, target).inFile(name))
+			continue
+		}
+		resolved := filepath.ToSlash(filepath.Join(filepath.Dir(name), target))
+		if resolved == ".." || strings.HasPrefix(resolved, "../") {
+			errs = append(errs, newError(CodeLinkOutside, "link '%s' points to '%s' which is outside the alterverse", name, target).inFile(name))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// Merge performs a three-way merge between the files deduced the last time, the
+// files currently present in the destination and the files deduced. This way
+// changes, additions and deletions made in the destination since the last
+// deduce are preserved, see mergeFiles. Changes that conflict with the deduced
+// files are enclosed in conflict markers, the files affected are returned along
+// with the number of conflicts.
+func (d *Deduction) Merge() (map[string]int, error) {
+	base, err := d.To.LastDeduced()
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		return map[string]int{}, nil
+	}
+	merged, conflicts := mergeFiles(base, d.Current, d.baseline, d.Renames)
+	d.Deduced = merged
+	return conflicts, nil
+}
+
+// Diff compares the current and the deduced files of the destination
+// alterverse, see DiffFiles for details.
+func (d Deduction) Diff() (diffs map[string]string, obsolete, created map[string][]byte, renamed map[string]string) {
+	return DiffFiles(d.Current, d.Deduced, d.Renames)
+}
+
+// Drift returns the sorted lists of files that would be changed, deleted, created
+// and renamed (by their new name) in the destination alterverse.
+func (d Deduction) Drift() (changed, deleted, created, renamed []string) {
+	diffs, toDelete, toCreate, toRename := d.Diff()
+	changed, deleted, created, renamed = []string{}, []string{}, []string{}, []string{}
+	modes := d.ModeChanges()
+	for filename, diff := range diffs {
+		_, modeChanged := modes[filename]
+		if _, ok := toRename[filename]; ok {
+			renamed = append(renamed, filename)
+		} else if diff != "" || modeChanged {
+			changed = append(changed, filename)
+		}
+	}
+	for filename := range toDelete {
+		deleted = append(deleted, filename)
+	}
+	for filename := range toCreate {
+		created = append(created, filename)
+	}
+	sort.Strings(changed)
+	sort.Strings(deleted)
+	sort.Strings(created)
+	sort.Strings(renamed)
+	return
+}
+
+// ModeChange describes a change of the permissions of a file.
+type ModeChange struct {
+	From os.FileMode
+	To   os.FileMode
+}
+
+func (m ModeChange) String() string {
+	return fmt.Sprintf("%s -> %s", formatMode(m.From), formatMode(m.To))
+}
+
+// formatMode returns the permissions of a file in octal notation or 'symlink'
+// for symbolic links.
+func formatMode(m os.FileMode) string {
+	if m&os.ModeSymlink != 0 {
+		return "symlink"
+	}
+	return fmt.Sprintf("%04o", m.Perm())
+}
+
+// ModeChanges returns the files present in the destination alterverse (by
+// their new name) whose permissions or type (symbolic link or regular file)
+// differ from the deduced ones.
+func (d Deduction) ModeChanges() map[string]ModeChange {
+	oldNames := map[string]string{}
+	for oldName, newName := range d.Renames {
+		oldNames[newName] = oldName
+	}
+
+	out := map[string]ModeChange{}
+	for name, deduced := range d.DeducedMeta {
+		currentName := name
+		if _, ok := d.Current[name]; !ok {
+			currentName = oldNames[name]
+		}
+		current, ok := d.CurrentMeta[currentName]
+		if !ok || current.Mode == deduced.Mode {
+			continue
+		}
+		out[name] = ModeChange{From: current.Mode, To: deduced.Mode}
+	}
+	return out
+}
+
+// InSync returns true if writing the deduction would not alter the
+// destination alterverse.
+func (d Deduction) InSync() bool {
+	changed, deleted, created, renamed := d.Drift()
+	return len(changed)+len(deleted)+len(created)+len(renamed) == 0
+}
+
+// Write writes the deduced files to the destination alterverse and records
+// them as the base for later merges. The files present before are backed up
+// and can be restored, see Alterverse.Undo.
+func (d Deduction) Write() error {
+	err := d.To.saveBackup(d.Current, d.CurrentMeta)
+	if err != nil {
+		return fmt.Errorf("failed backing up '%s', error is: %s", d.To.location, err.Error())
+	}
+	err = d.To.WriteFiles(d.Deduced, d.DeducedMeta)
+	if err != nil {
+		return err
+	}
+	err = d.To.WriteMeta(d.DeducedMeta, d.PreserveModTimes)
+	if err != nil {
+		return err
+	}
+	return d.To.saveLastDeduced(d.baseline)
+}
+
+// Reverse maps the files which have been changed in the destination alterverse
+// since the last deduce back to the source alterverse. The base holds the files
+// deduced the last time, see Alterverse.LastDeduced, only files which differ
+// from the base in the destination are mapped back. It returns the files that
+// need to be written to and deleted from the source alterverse along with the
+// metadata of the files to write. Files that have been changed in the source as
+// well, files that cannot be mapped back unambiguously as well as files
+// containing kept regions are refused.
+func (d Deduction) Reverse(base map[string][]byte) (write, del map[string][]byte, meta map[string]FileMeta, errs []error) {
+	write, del, meta, errs = map[string][]byte{}, map[string][]byte{}, map[string]FileMeta{}, []error{}
+	if base == nil {
+		errs = append(errs, newError(CodeMissingBase, "the destination has never been deduced, changes made in it cannot be told apart from changes made in the source"))
+		return
+	}
+
+	sourceNames := map[string]string{}
+	for sourceName, name := range d.Renames {
+		sourceNames[name] = sourceName
+	}
+	// sourceChanged returns true if the file deduced differs from the one
+	// deduced the last time, thus the source has been changed since.
+	sourceChanged := func(name string) bool {
+		baseData, inBase := base[name]
+		deduced, inDeduced := d.Deduced[name]
+		return inBase != inDeduced || !bytes.Equal(baseData, deduced)
+	}
+
+	// files copied verbatim are passed through unchanged, only their paths
+	// are mapped back, skipped files are not mapped back at all
+	changed, verbatim := map[string][]byte{}, map[string][]byte{}
+	for name, data := range d.Current {
+		policy := d.binaryPolicy(name, data)
+		if policy == binarySkip {
+			continue
+		}
+		if baseData, ok := base[name]; ok && bytes.Equal(data, baseData) {
+			continue
+		}
+		if deduced, ok := d.Deduced[name]; ok && bytes.Equal(data, deduced) {
+			continue
+		}
+		if sourceChanged(name) {
+			errs = append(errs, newError(CodeMergeConflict, "file '%s' has been changed in the source and the destination since the last deduce", name).inFile(name))
+			continue
+		}
+		if policy == binaryCopy {
+			verbatim[name], data = data, nil
+		} else if bytes.Contains(data, []byte(keepBeginMarker)) {
+			errs = append(errs, newError(CodeKeptRegion, "file '%s' contains kept regions and cannot be reversed", name).inFile(name))
+			continue
+		}
+		changed[name] = data
+	}
+	for name := range base {
+		if _, ok := d.Current[name]; ok {
+			continue
+		}
+		if _, ok := d.Deduced[name]; !ok {
+			continue
+		}
+		if sourceChanged(name) {
+			errs = append(errs, newError(CodeMergeConflict, "file '%s' has been deleted in the destination but changed in the source since the last deduce", name).inFile(name))
+			continue
+		}
+		del[sourceNames[name]] = nil
+	}
+
+	reverse := d.interverse.Reverse()
+	reversed, reverseErrs := reverse.DeduceStrict(changed)
+	errs = append(errs, reverseErrs...)
+	for name, data := range reversed {
+		write[name] = data
+	}
+	for name, sourceName := range reverse.DeducePaths(changed) {
+		if data, ok := verbatim[name]; ok {
+			write[sourceName] = data
+		}
+		if m, ok := d.CurrentMeta[name]; ok {
+			meta[sourceName] = m
+		}
+	}
+
+	return write, del, meta, errs
+}
+
+// binaryPolicy returns the binary policy of the destination file passed. Files
+// deduced get the policy applied when deducing, for other files the binary
+// rules of the source alterverse are matched, see Alterverse.binaryPolicy.
+func (d Deduction) binaryPolicy(name string, data []byte) string {
+	if policy, ok := d.Binary[name]; ok {
+		return policy
+	}
+	if _, ok := d.Deduced[name]; ok {
+		return ""
+	}
+	if d.From != nil {
+		return d.From.binaryPolicy(name, data)
+	}
+	if isBinary(data) {
+		return binaryCopy
+	}
+	return ""
+}
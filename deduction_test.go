@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDrift(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		d                                  Deduction
+		changed, deleted, created, renamed []string
+		inSync                             bool
+	}{
+		"InSync": {
+			d: Deduction{
+				Current: map[string][]byte{"a": []byte(`a`)},
+				Deduced: map[string][]byte{"a": []byte(`a`)},
+				Renames: map[string]string{"a": "a"},
+			},
+			changed: []string{}, deleted: []string{}, created: []string{}, renamed: []string{},
+			inSync: true,
+		},
+		"Drifted": {
+			d: Deduction{
+				Current: map[string][]byte{"a": []byte(`a`), "b": []byte(`b`), "prod": []byte(`x`), "old": []byte(`o`)},
+				Deduced: map[string][]byte{"a": []byte(`aa`), "b": []byte(`b`), "test": []byte(`x`), "new": []byte(`n`)},
+				Renames: map[string]string{"a": "a", "b": "b", "prod": "test", "new": "new"},
+			},
+			changed: []string{"a"}, deleted: []string{"old"}, created: []string{"new"}, renamed: []string{"test"},
+			inSync: false,
+		},
+		"ModeChanged": {
+			d: Deduction{
+				Current:     map[string][]byte{"a": []byte(`a`), "prod": []byte(`x`)},
+				Deduced:     map[string][]byte{"a": []byte(`a`), "test": []byte(`x`)},
+				Renames:     map[string]string{"a": "a", "prod": "test"},
+				CurrentMeta: map[string]FileMeta{"a": {Mode: 0644}, "prod": {Mode: 0644}},
+				DeducedMeta: map[string]FileMeta{"a": {Mode: 0755}, "test": {Mode: 0755}},
+			},
+			changed: []string{"a"}, deleted: []string{}, created: []string{}, renamed: []string{"test"},
+			inSync: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			changed, deleted, created, renamed := test.d.Drift()
+			if !reflect.DeepEqual(changed, test.changed) {
+				t.Errorf("changed is not as expected: is %v, expected %v", changed, test.changed)
+			}
+			if !reflect.DeepEqual(deleted, test.deleted) {
+				t.Errorf("deleted is not as expected: is %v, expected %v", deleted, test.deleted)
+			}
+			if !reflect.DeepEqual(created, test.created) {
+				t.Errorf("created is not as expected: is %v, expected %v", created, test.created)
+			}
+			if !reflect.DeepEqual(renamed, test.renamed) {
+				t.Errorf("renamed is not as expected: is %v, expected %v", renamed, test.renamed)
+			}
+			if test.d.InSync() != test.inSync {
+				t.Errorf("in sync should be %t", test.inSync)
+			}
+		})
+	}
+}
+
+func TestNewDeduction(t *testing.T) {
+	t.Parallel()
+	location := filepath.Join(testdata, "alterverse_ok")
+	a, errs := NewAlterverse(location, defaultIgnore)
+	if len(errs) > 0 {
+		t.Fatalf("could not create alterverse, errors were: %v", errs)
+	}
+	files, err := a.Files()
+	if err != nil {
+		t.Fatalf("could not read files, error was: %s", err.Error())
+	}
+
+	d, errs := NewDeduction(a, files, a)
+	if len(errs) > 0 {
+		t.Fatalf("could not create deduction, errors were: %v", errs)
+	}
+	if !d.InSync() {
+		t.Errorf("alterverse deduced from itself should be in sync")
+	}
+}
+
+func TestNewDeductionSubtrees(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		from, to    string
+		deduced     map[string][]byte
+		errExpected bool
+	}{
+		"Subtree": {
+			from: "subtree_source",
+			to:   "subtree_destination",
+			deduced: map[string][]byte{
+				"main.tf":                  []byte("env=test account=333333333333\n"),
+				"services/billing/main.tf": []byte("env=test account=444444444444\n"),
+			},
+		},
+		"SubtreeOverridesItsDirectory": {
+			// the directory is deduced by the root, the files below it by
+			// the subtree
+			from: "subtree_override_source",
+			to:   "subtree_override_destination",
+			deduced: map[string][]byte{
+				"test/main.tf": []byte("env=stage\n"),
+			},
+		},
+		"SubtreeWithoutCounterpart": {
+			from:        "subtree_source",
+			to:          "subtree_orphan",
+			errExpected: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			from, errs := NewAlterverse(filepath.Join(testdata, test.from), defaultIgnore)
+			if len(errs) > 0 {
+				t.Fatalf("could not create alterverse, errors were: %v", errs)
+			}
+			files, err := from.Files()
+			if err != nil {
+				t.Fatalf("could not read files, error was: %s", err.Error())
+			}
+			to, errs := NewAlterverse(filepath.Join(testdata, test.to), defaultIgnore)
+			if len(errs) > 0 {
+				t.Fatalf("could not create alterverse, errors were: %v", errs)
+			}
+			d, errs := NewDeduction(from, files, to)
+			if hasErrs(errs...) && !test.errExpected {
+				t.Errorf("has unexpected errors, errors are: %v", errs)
+			} else if !hasErrs(errs...) && test.errExpected {
+				t.Errorf("errors expected but no errors occurred")
+			}
+			if test.errExpected {
+				return
+			}
+			if !reflect.DeepEqual(d.Deduced, test.deduced) {
+				t.Errorf("deduced files are not as expected: is %q, expected %q", d.Deduced, test.deduced)
+			}
+			for name, sourceName := range d.interverse.Reverse().DeducePaths(d.Deduced) {
+				if d.Renames[sourceName] != name {
+					t.Errorf("file '%s' is not reversed to its source, is reversed to '%s'", name, sourceName)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	t.Parallel()
+	link := FileMeta{Mode: os.ModeSymlink | 0777}
+	tests := map[string]struct {
+		files       map[string][]byte
+		meta        map[string]FileMeta
+		errExpected bool
+	}{
+		"Inside": {
+			files: map[string][]byte{"a/current": []byte("../b/prod"), "b/prod": nil},
+			meta:  map[string]FileMeta{"a/current": link},
+		},
+		"RegularFile": {
+			files: map[string][]byte{"a": []byte("/etc/passwd")},
+			meta:  map[string]FileMeta{},
+		},
+		"Absolute": {
+			files:       map[string][]byte{"a": []byte("/etc/passwd")},
+			meta:        map[string]FileMeta{"a": link},
+			errExpected: true,
+		},
+		"Outside": {
+			files:       map[string][]byte{"a/current": []byte("../../prod")},
+			meta:        map[string]FileMeta{"a/current": link},
+			errExpected: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			errs := checkLinks(test.files, test.meta)
+			if hasErrs(errs...) && !test.errExpected {
+				t.Errorf("has unexpected errors, errors are: %v", errs)
+			} else if !hasErrs(errs...) && test.errExpected {
+				t.Errorf("errors expected but no errors occurred")
+			}
+			for _, err := range errs {
+				if code := asError(err).Code; code != CodeLinkOutside {
+					t.Errorf("error code is not as expected: is %s, expected %s", code, CodeLinkOutside)
+				}
+			}
+		})
+	}
+}
+
+func TestNewDeductionLinks(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		links  string
+		target string
+	}{
+		"Substitute": {links: linksSubstitute, target: "test.yml"},
+		"Keep":       {links: linksKeep, target: "production.yml"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dirs := map[string]string{}
+			for _, env := range []string{"production", "test"} {
+				dir, err := ioutil.TempDir("", "omniverse")
+				if err != nil {
+					t.Fatalf("could not create temporary directory, error was: %s", err.Error())
+				}
+				defer os.RemoveAll(dir)
+				manifest := fmt.Sprintf("manifest:\n  env: %s\nlinks: %s\n", env, test.links)
+				err = ioutil.WriteFile(filepath.Join(dir, alterverseFile), []byte(manifest), 0644)
+				if err != nil {
+					t.Fatalf("could not write manifest, error was: %s", err.Error())
+				}
+				dirs[env] = dir
+			}
+			err := os.Symlink("production.yml", filepath.Join(dirs["production"], "current-production.yml"))
+			if err != nil {
+				t.Fatalf("could not create link, error was: %s", err.Error())
+			}
+
+			from, errs := NewAlterverse(dirs["production"], defaultIgnore)
+			if len(errs) > 0 {
+				t.Fatalf("could not create alterverse, errors were: %v", errs)
+			}
+			to, errs := NewAlterverse(dirs["test"], defaultIgnore)
+			if len(errs) > 0 {
+				t.Fatalf("could not create alterverse, errors were: %v", errs)
+			}
+			files, err := from.Files()
+			if err != nil {
+				t.Fatalf("could not read files, error was: %s", err.Error())
+			}
+			d, errs := NewDeduction(from, files, to)
+			if len(errs) > 0 {
+				t.Fatalf("could not create deduction, errors were: %v", errs)
+			}
+			if target := string(d.Deduced["current-test.yml"]); target != test.target {
+				t.Errorf("target of the link is not as expected: is %s, expected %s", target, test.target)
+			}
+			if !d.DeducedMeta["current-test.yml"].IsSymlink() {
+				t.Errorf("deduced file should be a symbolic link")
+			}
+		})
+	}
+}
+
+func TestDeductionReverse(t *testing.T) {
+	t.Parallel()
+	interverse, err := NewInterverse(Manifest{"env": "production"}, Manifest{"env": "test"})
+	if err != nil {
+		t.Fatalf("could not create interverse, error was: %s", err.Error())
+	}
+	tests := map[string]struct {
+		noBase      bool
+		binary      map[string]string
+		deduced     map[string][]byte
+		current     map[string][]byte
+		currentMeta map[string]FileMeta
+		write, del  map[string][]byte
+		meta        map[string]FileMeta
+		errExpected bool
+		code        ErrorCode
+	}{
+		"Unchanged": {
+			current: map[string][]byte{"test/a": []byte("env=test"), "b": []byte("b")},
+			write:   map[string][]byte{},
+			del:     map[string][]byte{},
+			meta:    map[string]FileMeta{},
+		},
+		"Changed": {
+			current: map[string][]byte{"test/a": []byte("env=test\nfix=test"), "c": []byte("new")},
+			write:   map[string][]byte{"production/a": []byte("env=production\nfix=production"), "c": []byte("new")},
+			del:     map[string][]byte{"b": nil},
+			meta:    map[string]FileMeta{},
+		},
+		"Link": {
+			current:     map[string][]byte{"test/a": []byte("env=test"), "b": []byte("b"), "test/l": []byte("../test/a")},
+			currentMeta: map[string]FileMeta{"test/l": {Mode: os.ModeSymlink | 0777}},
+			write:       map[string][]byte{"production/l": []byte("../production/a")},
+			del:         map[string][]byte{},
+			meta:        map[string]FileMeta{"production/l": {Mode: os.ModeSymlink | 0777}},
+		},
+		"Ambiguous": {
+			current:     map[string][]byte{"test/a": []byte("env=test or production"), "b": []byte("b")},
+			errExpected: true,
+		},
+		"KeptRegion": {
+			current:     map[string][]byte{"test/a": []byte("env=test\n# omniverse:keep begin\nx\n# omniverse:keep end\n"), "b": []byte("b")},
+			errExpected: true,
+			code:        CodeKeptRegion,
+		},
+		"SourceChanged": {
+			deduced: map[string][]byte{"test/a": []byte("env=test\nfix=test"), "c": []byte("new")},
+			current: map[string][]byte{"test/a": []byte("env=test"), "b": []byte("b")},
+			write:   map[string][]byte{},
+			del:     map[string][]byte{},
+			meta:    map[string]FileMeta{},
+		},
+		"SameChange": {
+			deduced: map[string][]byte{"test/a": []byte("env=test\nfix=test"), "b": []byte("b")},
+			current: map[string][]byte{"test/a": []byte("env=test\nfix=test"), "b": []byte("b")},
+			write:   map[string][]byte{},
+			del:     map[string][]byte{},
+			meta:    map[string]FileMeta{},
+		},
+		"Conflict": {
+			deduced:     map[string][]byte{"test/a": []byte("env=test\nfix=test"), "b": []byte("b")},
+			current:     map[string][]byte{"test/a": []byte("env=test\nother=test"), "b": []byte("b")},
+			errExpected: true,
+			code:        CodeMergeConflict,
+		},
+		"DeletedButSourceChanged": {
+			deduced:     map[string][]byte{"test/a": []byte("env=test"), "b": []byte("new b")},
+			current:     map[string][]byte{"test/a": []byte("env=test")},
+			errExpected: true,
+		},
+		"BinaryCopied": {
+			current: map[string][]byte{"test/a": []byte("env=test"), "b": []byte("b"), "test/logo.png": []byte("\x89PNG\r\n\x1a\ntest")},
+			write:   map[string][]byte{"production/logo.png": []byte("\x89PNG\r\n\x1a\ntest")},
+			del:     map[string][]byte{},
+			meta:    map[string]FileMeta{},
+		},
+		"BinarySkipped": {
+			binary:  map[string]string{"b": binarySkip},
+			current: map[string][]byte{"test/a": []byte("env=test"), "b": []byte("test")},
+			write:   map[string][]byte{},
+			del:     map[string][]byte{},
+			meta:    map[string]FileMeta{},
+		},
+		"NoBase": {
+			noBase:      true,
+			current:     map[string][]byte{"test/a": []byte("env=test\nfix=test"), "b": []byte("b")},
+			errExpected: true,
+			code:        CodeMissingBase,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			base := map[string][]byte{"test/a": []byte("env=test"), "b": []byte("b")}
+			deduced := test.deduced
+			if deduced == nil {
+				deduced = base
+			}
+			if test.noBase {
+				base = nil
+			}
+			d := Deduction{
+				Current:     test.current,
+				CurrentMeta: test.currentMeta,
+				Deduced:     deduced,
+				Renames:     map[string]string{"production/a": "test/a", "b": "b"},
+				Binary:      test.binary,
+				interverse:  interverseTree{{interverse: interverse}},
+			}
+			write, del, meta, errs := d.Reverse(base)
+			if hasErrs(errs...) && !test.errExpected {
+				t.Errorf("has unexpected errors, errors are: %v", errs)
+			} else if !hasErrs(errs...) && test.errExpected {
+				t.Errorf("errors expected but no errors occurred")
+			}
+			for _, err := range errs {
+				if code := asError(err).Code; test.code != "" && code != test.code {
+					t.Errorf("error code is not as expected: is %s, expected %s", code, test.code)
+				}
+			}
+			if test.errExpected {
+				return
+			}
+			if !reflect.DeepEqual(write, test.write) {
+				t.Errorf("files to write are not as expected: is %v, expected %v", write, test.write)
+			}
+			if !reflect.DeepEqual(del, test.del) {
+				t.Errorf("files to delete are not as expected: is %v, expected %v", del, test.del)
+			}
+			if !reflect.DeepEqual(meta, test.meta) {
+				t.Errorf("metadata of files to write is not as expected: is %v, expected %v", meta, test.meta)
+			}
+		})
+	}
+}
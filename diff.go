@@ -4,13 +4,33 @@ import (
 	"bufio"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
-func DiffFiles(a, b map[string][]byte) (diffs map[string]string, obsolete, created map[string][]byte) {
+// DiffFiles compares the files a (the current state) with the files b (the
+// desired state). The renames passed map a file path in a to the path in b it
+// is expected to be moved to. The diffs returned are keyed by the path in b,
+// renamed maps the new path of every renamed file to its old path.
+func DiffFiles(a, b map[string][]byte, renames map[string]string) (diffs map[string]string, obsolete, created map[string][]byte, renamed map[string]string) {
 	common, obsolete, created := findCommonFiles(a, b)
 
+	renamed = map[string]string{}
+	for oldName, newName := range renames {
+		if oldName == newName {
+			continue
+		}
+		_, isObsolete := obsolete[oldName]
+		_, isCreated := created[newName]
+		if !isObsolete || !isCreated {
+			continue
+		}
+		delete(obsolete, oldName)
+		delete(created, newName)
+		renamed[newName] = oldName
+	}
+
 	diffs = map[string]string{}
 	dmp := diffmatchpatch.New()
 	for k := range common {
@@ -20,6 +40,13 @@ func DiffFiles(a, b map[string][]byte) (diffs map[string]string, obsolete, creat
 		diff := dmp.DiffMain(dataA, dataB, false)
 		diffs[k] = getLineDiff(diff, dmp)
 	}
+	for newName, oldName := range renamed {
+		dataA := string(a[oldName])
+		dataB := string(b[newName])
+
+		diff := dmp.DiffMain(dataA, dataB, false)
+		diffs[newName] = getLineDiff(diff, dmp)
+	}
 
 	return
 }
@@ -48,3 +75,47 @@ func getLineDiff(diff []diffmatchpatch.Diff, dmp *diffmatchpatch.DiffMatchPatch)
 	}
 	return out
 }
+
+// lineOp is an operation of a line based diff spanning a number of lines.
+type lineOp struct {
+	Type  diffmatchpatch.Operation
+	Lines int
+}
+
+// lineDiff compares the data a and b line by line and returns the list of
+// operations required to turn a into b.
+func lineDiff(a, b []byte) []lineOp {
+	dmp := diffmatchpatch.New()
+	runesA, runesB, _ := dmp.DiffLinesToRunes(string(a), string(b))
+	diffs := dmp.DiffMainRunes(runesA, runesB, false)
+
+	ops := []lineOp{}
+	for _, diff := range diffs {
+		ops = append(ops, lineOp{Type: diff.Type, Lines: utf8.RuneCountInString(diff.Text)})
+	}
+	return ops
+}
+
+// matchLines compares the data a and b line by line and returns a slice which
+// contains the index of the matching line in b for every line in a, or -1 if
+// the line has no match.
+func matchLines(a, b []byte) []int {
+	matches := []int{}
+	indexB := 0
+	for _, op := range lineDiff(a, b) {
+		switch op.Type {
+		case diffmatchpatch.DiffEqual:
+			for i := 0; i < op.Lines; i++ {
+				matches = append(matches, indexB+i)
+			}
+			indexB += op.Lines
+		case diffmatchpatch.DiffDelete:
+			for i := 0; i < op.Lines; i++ {
+				matches = append(matches, -1)
+			}
+		case diffmatchpatch.DiffInsert:
+			indexB += op.Lines
+		}
+	}
+	return matches
+}
@@ -10,9 +10,11 @@ func TestDiffFiles(t *testing.T) {
 	tests := map[string]struct {
 		a        map[string][]byte
 		b        map[string][]byte
+		renames  map[string]string
 		diffs    map[string]bool
 		obsolete map[string][]byte
 		created  map[string][]byte
+		renamed  map[string]string
 	}{
 		"NoFiles": {
 			a:        map[string][]byte{},
@@ -20,6 +22,7 @@ func TestDiffFiles(t *testing.T) {
 			diffs:    map[string]bool{},
 			obsolete: map[string][]byte{},
 			created:  map[string][]byte{},
+			renamed:  map[string]string{},
 		},
 		"Similar": {
 			a: map[string][]byte{
@@ -36,6 +39,7 @@ func TestDiffFiles(t *testing.T) {
 			},
 			obsolete: map[string][]byte{},
 			created:  map[string][]byte{},
+			renamed:  map[string]string{},
 		},
 		"HasDiff": {
 			a: map[string][]byte{
@@ -52,12 +56,36 @@ func TestDiffFiles(t *testing.T) {
 			},
 			obsolete: map[string][]byte{},
 			created:  map[string][]byte{},
+			renamed:  map[string]string{},
+		},
+		"Renamed": {
+			a: map[string][]byte{
+				"prod/a": []byte(`prod`),
+				"b":      []byte(`b`),
+				"c":      []byte(`c`),
+			},
+			b: map[string][]byte{
+				"test/a": []byte(`test`),
+				"b":      []byte(`b`),
+				"d":      []byte(`d`),
+			},
+			renames: map[string]string{
+				"prod/a": "test/a",
+				"b":      "b",
+			},
+			diffs: map[string]bool{
+				"test/a": true,
+				"b":      false,
+			},
+			obsolete: map[string][]byte{"c": []byte(`c`)},
+			created:  map[string][]byte{"d": []byte(`d`)},
+			renamed:  map[string]string{"test/a": "prod/a"},
 		},
 	}
 
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			diffs, obsolete, created := DiffFiles(test.a, test.b)
+			diffs, obsolete, created, renamed := DiffFiles(test.a, test.b, test.renames)
 			for file, diff := range diffs {
 				shouldHaveDiff, ok := test.diffs[file]
 				if !ok {
@@ -75,6 +103,9 @@ func TestDiffFiles(t *testing.T) {
 			if !reflect.DeepEqual(created, test.created) {
 				t.Errorf("created is not as expected")
 			}
+			if !reflect.DeepEqual(renamed, test.renamed) {
+				t.Errorf("renamed is not as expected")
+			}
 		})
 	}
 
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ErrorCode identifies the kind of an Error.
+type ErrorCode string
+
+const (
+	CodeUnknown          ErrorCode = "unknown"
+	CodeInvalidLocation  ErrorCode = "invalid_location"
+	CodeInvalidIgnore    ErrorCode = "invalid_ignore"
+	CodeInvalidManifest  ErrorCode = "invalid_manifest"
+	CodeManifestCycle    ErrorCode = "manifest_cycle"
+	CodeUndefinedValue   ErrorCode = "undefined_value"
+	CodeDuplicateValue   ErrorCode = "duplicate_value"
+	CodeMissingKey       ErrorCode = "missing_key"
+	CodeInvalidOptions   ErrorCode = "invalid_options"
+	CodeValueCollision   ErrorCode = "value_collision"
+	CodeOrphanSubtree    ErrorCode = "orphan_subtree"
+	CodeDestinationValue ErrorCode = "destination_value"
+	CodeRoundTrip        ErrorCode = "round_trip"
+	CodePathCollision    ErrorCode = "path_collision"
+	CodeKeptRegion       ErrorCode = "kept_region"
+	CodeMergeConflict    ErrorCode = "merge_conflict"
+	CodeLinkOutside      ErrorCode = "link_outside"
+	CodeNoBackup         ErrorCode = "no_backup"
+	CodeMissingBase      ErrorCode = "missing_base"
+)
+
+// Error is an error which carries a code and, if known, the file and the
+// manifest key it relates to. This allows to process errors by machines.
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	File    string    `json:"file,omitempty"`
+	Key     string    `json:"key,omitempty"`
+	// Line and Column locate the error within the file, both are one based.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// newError returns an Error with the code passed and the message formatted
+// according to the format specifier.
+func newError(code ErrorCode, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// inFile sets the file the error relates to.
+func (e *Error) inFile(file string) *Error {
+	e.File = file
+	return e
+}
+
+// forKey sets the manifest key the error relates to.
+func (e *Error) forKey(key string) *Error {
+	e.Key = key
+	return e
+}
+
+// at sets the line and the column the error is located at.
+func (e *Error) at(line, column int) *Error {
+	e.Line, e.Column = line, column
+	return e
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// asError returns a copy of the error passed as Error. Errors which are not
+// of type Error get the code CodeUnknown.
+func asError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		c := *e
+		return &c
+	}
+	return &Error{Code: CodeUnknown, Message: err.Error()}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestErrorCodes(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		from, to Manifest
+		opts     Options
+		files    map[string][]byte
+		code     ErrorCode
+	}{
+		"MissingKey": {
+			from: Manifest{"env": "production", "region": "eu"},
+			to:   Manifest{"env": "test"},
+			code: CodeMissingKey,
+		},
+		"InvalidOptions": {
+			from: Manifest{"env": "production"},
+			to:   Manifest{"env": "test"},
+			opts: Options{"env": {Match: "fuzzy"}},
+			code: CodeInvalidOptions,
+		},
+		"ValueCollision": {
+			from: Manifest{"env": "production", "other": "PRODUCTION"},
+			to:   Manifest{"env": "test", "other": "integration"},
+			opts: Options{"env": {Variants: []string{"upper"}}},
+			code: CodeValueCollision,
+		},
+		"DestinationValue": {
+			from:  Manifest{"env": "production"},
+			to:    Manifest{"env": "test"},
+			files: map[string][]byte{"a": []byte("test")},
+			code:  CodeDestinationValue,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			i, err := NewInterverseWithOptions(test.from, test.to, test.opts)
+			errs := []error{err}
+			if err == nil {
+				_, errs = i.DeduceStrict(test.files)
+			}
+			if len(errs) == 0 || errs[0] == nil {
+				t.Fatalf("error with code '%s' expected but no error occurred", test.code)
+			}
+			if code := asError(errs[0]).Code; code != test.code {
+				t.Errorf("code is not as expected: is %s, expected %s, error is: %s", code, test.code, errs[0])
+			}
+		})
+	}
+}
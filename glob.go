@@ -0,0 +1,74 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// compileGlob converts the glob pattern passed into a regular expression
+// matching slash separated paths. '*' matches any sequence of characters
+// except '/', '?' matches a single character except '/', '**' matches any
+// sequence of characters including '/' and character classes such as '[a-z]'
+// or '[!a-z]' are supported. A '**/' prefix also matches no directory at all.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				re.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// compileGlobs compiles all glob patterns passed.
+func compileGlobs(patterns []string) ([]*regexp.Regexp, error) {
+	out := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		re, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+// matchesAny returns true if any of the regular expressions passed matches
+// the path passed.
+func matchesAny(res []*regexp.Regexp, path string) bool {
+	for _, re := range res {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCompileGlob(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		pattern       string
+		path          string
+		matchExpected bool
+	}{
+		{pattern: "terraform/**", path: "terraform/main.tf", matchExpected: true},
+		{pattern: "terraform/**", path: "terraform/modules/lb/main.tf", matchExpected: true},
+		{pattern: "terraform/**", path: "docs/terraform/main.tf", matchExpected: false},
+		{pattern: "**/*.tf", path: "main.tf", matchExpected: true},
+		{pattern: "**/*.tf", path: "terraform/modules/main.tf", matchExpected: true},
+		{pattern: "**/*.tf", path: "main.tf.bak", matchExpected: false},
+		{pattern: "*.md", path: "README.md", matchExpected: true},
+		{pattern: "*.md", path: "docs/README.md", matchExpected: false},
+		{pattern: "file?.txt", path: "file1.txt", matchExpected: true},
+		{pattern: "file?.txt", path: "file/.txt", matchExpected: false},
+		{pattern: "file[0-9].txt", path: "file5.txt", matchExpected: true},
+		{pattern: "file[!0-9].txt", path: "file5.txt", matchExpected: false},
+		{pattern: "a.b", path: "axb", matchExpected: false},
+		{pattern: `\*.txt`, path: "*.txt", matchExpected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.path, func(t *testing.T) {
+			re, err := compileGlob(test.pattern)
+			if err != nil {
+				t.Fatalf("could not compile glob, error was: %s", err.Error())
+			}
+			if re.MatchString(test.path) != test.matchExpected {
+				t.Errorf("glob '%s' matching '%s' should be %t", test.pattern, test.path, test.matchExpected)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileNames lists the gitignore-style pattern files read from the
+// directories of an alterverse. Patterns of later files take precedence.
+var ignoreFileNames = []string{".gitignore", ".alterverseignore"}
+
+// ignoreRule is a single pattern of an ignore file.
+type ignoreRule struct {
+	// base is the slash separated directory of the ignore file relative to
+	// the basedir, it is empty for the basedir itself.
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules holds the rules of all ignore files of a directory tree ordered
+// from the root to the leaves. As with git the last rule matching a path wins.
+type ignoreRules []ignoreRule
+
+// readIgnoreRules reads the ignore files of the directory passed and all its
+// subdirectories. Directories which are ignored or reserved are not searched.
+func readIgnoreRules(basedir string) (ignoreRules, error) {
+	rules := ignoreRules{}
+	err := filepath.Walk(basedir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(basedir, p)
+		if err != nil {
+			return err
+		}
+		rel = normalizePath(rel)
+		if rel != "" && (isReserved(rel) || rules.ignored(rel, true)) {
+			return filepath.SkipDir
+		}
+
+		for _, name := range ignoreFileNames {
+			data, err := ioutil.ReadFile(filepath.Join(p, name))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			parsed, err := parseIgnoreFile(data, rel)
+			if err != nil {
+				return asError(err).inFile(path.Join(rel, name))
+			}
+			rules = append(rules, parsed...)
+		}
+		return nil
+	})
+	return rules, err
+}
+
+// parseIgnoreFile parses the content of a gitignore-style file located in the
+// directory base. Empty lines and lines starting with '#' are skipped, a
+// leading '!' negates the pattern and a trailing '/' restricts the pattern to
+// directories. Patterns without a '/' other than a trailing one match at any
+// depth, all others are relative to the directory of the file.
+func parseIgnoreFile(data []byte, base string) (ignoreRules, error) {
+	rules := ignoreRules{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimRight(scanner.Text(), " \t\r")
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(pattern, "!") {
+			rule.negate, pattern = true, pattern[1:]
+		} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			rule.dirOnly, pattern = true, strings.TrimRight(pattern, "/")
+		}
+		if strings.Contains(pattern, "/") {
+			pattern = strings.TrimPrefix(pattern, "/")
+		} else {
+			pattern = "**/" + pattern
+		}
+
+		re, err := compileGlob(pattern)
+		if err != nil {
+			return nil, newError(CodeInvalidIgnore, "ignore pattern '%s' could not be compiled: %s", scanner.Text(), err.Error()).at(line, 1)
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// ignored returns true if the slash separated path relative to the basedir
+// passed is ignored. A path is also ignored if any of its parent directories
+// is ignored, negations cannot include files of an ignored directory.
+func (rules ignoreRules) ignored(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if rules.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return rules.match(rel, isDir)
+}
+
+// match returns true if the last rule matching the path passed ignores it.
+func (rules ignoreRules) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		p := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			p = strings.TrimPrefix(rel, rule.base+"/")
+		}
+		if rule.re.MatchString(p) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
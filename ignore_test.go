@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	t.Parallel()
+	root, err := parseIgnoreFile([]byte("# build output\n*.log\n!keep.log\nbuild/\n/tmp\n"), "")
+	if err != nil {
+		t.Fatalf("could not parse ignore file, error was: %s", err.Error())
+	}
+	sub, err := parseIgnoreFile([]byte("*.tfstate\n!debug.log\n"), "terraform")
+	if err != nil {
+		t.Fatalf("could not parse ignore file, error was: %s", err.Error())
+	}
+	rules := append(root, sub...)
+
+	tests := []struct {
+		path           string
+		isDir          bool
+		ignoreExpected bool
+	}{
+		{path: "app.log", ignoreExpected: true},
+		{path: "logs/app.log", ignoreExpected: true},
+		{path: "keep.log", ignoreExpected: false},
+		{path: "build", isDir: true, ignoreExpected: true},
+		{path: "build", ignoreExpected: false},
+		{path: "build/main.go", ignoreExpected: true},
+		{path: "src/build/main.go", ignoreExpected: true},
+		{path: "tmp/a", ignoreExpected: true},
+		{path: "src/tmp/a", ignoreExpected: false},
+		{path: "terraform/main.tfstate", ignoreExpected: true},
+		{path: "main.tfstate", ignoreExpected: false},
+		{path: "terraform/debug.log", ignoreExpected: false},
+		{path: "debug.log", ignoreExpected: true},
+		{path: ".github/workflows/ci.yml", ignoreExpected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if rules.ignored(test.path, test.isDir) != test.ignoreExpected {
+				t.Errorf("path '%s' being ignored should be %t", test.path, test.ignoreExpected)
+			}
+		})
+	}
+}
+
+func TestSyncerIgnoreFiles(t *testing.T) {
+	t.Parallel()
+	basepath, err := ioutil.TempDir("", "omniverse")
+	if err != nil {
+		t.Fatalf("could not create temporary directory, error was: %s", err.Error())
+	}
+	defer os.RemoveAll(basepath)
+
+	files := map[string]string{
+		".gitignore":                "*.log\n",
+		".github/workflows/ci.yml":  "on: push",
+		".git/HEAD":                 "ref: refs/heads/main",
+		"app.log":                   "log",
+		"main.tf":                   "env=production",
+		"modules/.alterverseignore": "!debug.log\ngenerated/\n",
+		"modules/debug.log":         "log",
+		"modules/generated/lock.tf": "lock",
+	}
+	for name, data := range files {
+		path := filepath.Join(basepath, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(data), 0644)
+		}
+		if err != nil {
+			t.Fatalf("could not write file '%s', error was: %s", name, err.Error())
+		}
+	}
+
+	syncer, err := NewSyncer(basepath, "")
+	if err != nil {
+		t.Fatalf("syncer for '%s' could not be created, error was: %s", basepath, err.Error())
+	}
+	read, err := syncer.ReadFiles()
+	if err != nil {
+		t.Fatalf("could not read files, error was: %s", err.Error())
+	}
+	expected := asMap([]string{".gitignore", ".github/workflows/ci.yml", "main.tf", "modules/.alterverseignore", "modules/debug.log"})
+	if !checkSameFields(read, expected) {
+		t.Errorf("files read are not as expected: is %v, expected %v", read, expected)
+	}
+}
+
+func TestParseIgnoreFileInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := parseIgnoreFile([]byte("*.log\nfile[z-a]\n"), "")
+	if err == nil {
+		t.Fatalf("error expected but no error occurred")
+	}
+	if e := asError(err); e.Code != CodeInvalidIgnore || e.Line != 2 {
+		t.Errorf("error is not as expected: is %s at line %d, expected %s at line 2", e.Code, e.Line, CodeInvalidIgnore)
+	}
+}
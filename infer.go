@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// InferManifests compares the files a and b and proposes a pair of manifests
+// which allows to deduce the files b from the files a. Both manifests share the
+// same keys. The files which cannot be explained by the manifests proposed are
+// returned as a map where the keys are the file paths and the values describe
+// the reason. Errors occurred while verifying the manifests are returned as well.
+func InferManifests(a, b map[string][]byte) (from, to Manifest, unexplained map[string]string, errs []error) {
+	unexplained = map[string]string{}
+	common, onlyA, onlyB := findCommonFiles(a, b)
+
+	counts := map[string]map[string]int{}
+	dmp := diffmatchpatch.New()
+	for name := range common {
+		if bytes.Equal(a[name], b[name]) {
+			continue
+		}
+		diff := dmp.DiffMain(string(a[name]), string(b[name]), false)
+		diff = dmp.DiffCleanupSemantic(diff)
+		pairs, ok := substitutionPairs(diff)
+		if !ok {
+			unexplained[name] = "contains changes which are not substitutions"
+		}
+		for _, pair := range pairs {
+			if _, ok := counts[pair[0]]; !ok {
+				counts[pair[0]] = map[string]int{}
+			}
+			counts[pair[0]][pair[1]]++
+		}
+	}
+
+	from, to = manifestsFromCounts(counts)
+
+	interverse, err := NewInterverse(from, to)
+	if err != nil {
+		return from, to, unexplained, []error{err}
+	}
+	deduced, errs := interverse.DeduceStrict(a)
+	renames := interverse.DeducePaths(a)
+	for name := range a {
+		if _, ok := unexplained[name]; ok {
+			continue
+		}
+		data, ok := b[renames[name]]
+		if !ok {
+			if _, isOnlyA := onlyA[name]; isOnlyA {
+				unexplained[name] = "only present in source"
+			} else {
+				unexplained[name] = fmt.Sprintf("deduced to '%s' which is not present in destination", renames[name])
+			}
+		} else if !bytes.Equal(data, deduced[renames[name]]) {
+			unexplained[name] = "deduced content differs from destination"
+		}
+	}
+	for name := range onlyB {
+		if _, ok := deduced[name]; !ok {
+			unexplained[name] = "only present in destination"
+		}
+	}
+
+	return from, to, unexplained, errs
+}
+
+// substitutionPairs extracts all pairs of differing strings out of the diff
+// passed. The strings are expanded to full words. If the diff contains insertions
+// or deletions that cannot be expressed as a substitution the second return
+// value is false.
+func substitutionPairs(diff []diffmatchpatch.Diff) ([][2]string, bool) {
+	pairs := [][2]string{}
+	ok := true
+	for i := 0; i < len(diff); i++ {
+		if diff[i].Type == diffmatchpatch.DiffEqual {
+			continue
+		}
+
+		var deleted, inserted string
+		j := i
+		for ; j < len(diff) && diff[j].Type != diffmatchpatch.DiffEqual; j++ {
+			if diff[j].Type == diffmatchpatch.DiffDelete {
+				deleted += diff[j].Text
+			} else {
+				inserted += diff[j].Text
+			}
+		}
+
+		var lead, trail string
+		if i > 0 {
+			lead = trailingWord(diff[i-1].Text)
+		}
+		if j < len(diff) {
+			trail = leadingWord(diff[j].Text)
+		}
+
+		// changes containing white spaces are considered to be edits
+		// rather than substitutions
+		fromValue, toValue := lead+deleted+trail, lead+inserted+trail
+		if fromValue == "" || toValue == "" || strings.ContainsAny(deleted+inserted, " \t\r\n") {
+			ok = false
+		} else {
+			pairs = append(pairs, [2]string{fromValue, toValue})
+		}
+		i = j - 1
+	}
+	return pairs, ok
+}
+
+// manifestsFromCounts takes a map of source values to destination values and
+// the number of times they were observed and returns a pair of manifests. If a
+// value maps to multiple values the most frequent one is used.
+func manifestsFromCounts(counts map[string]map[string]int) (from, to Manifest) {
+	fromValues := make([]string, 0, len(counts))
+	for fromValue := range counts {
+		fromValues = append(fromValues, fromValue)
+	}
+	sort.Strings(fromValues)
+
+	from, to = Manifest{}, Manifest{}
+	used := map[string]bool{}
+	for _, fromValue := range fromValues {
+		toValue, best := "", 0
+		for candidate, count := range counts[fromValue] {
+			if count > best || (count == best && candidate < toValue) {
+				toValue, best = candidate, count
+			}
+		}
+		if used[toValue] {
+			continue
+		}
+		used[toValue] = true
+
+		key := manifestKey(fromValue)
+		for i := 2; ; i++ {
+			if _, exists := from[key]; !exists {
+				break
+			}
+			key = fmt.Sprintf("%s_%d", manifestKey(fromValue), i)
+		}
+		from[key] = fromValue
+		to[key] = toValue
+	}
+	return from, to
+}
+
+// manifestKey derives a manifest key from the value passed.
+func manifestKey(value string) string {
+	key := strings.Map(func(r rune) rune {
+		if isWordRune(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, value)
+	key = strings.Trim(key, "_")
+	if key == "" {
+		key = "key"
+	}
+	return key
+}
+
+// trailingWord returns the word characters at the end of the string passed.
+func trailingWord(s string) string {
+	i := len(s)
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(s[:i])
+		if !isWordRune(r) {
+			break
+		}
+		i -= size
+	}
+	return s[i:]
+}
+
+// leadingWord returns the word characters at the beginning of the string passed.
+func leadingWord(s string) string {
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !isWordRune(r) {
+			break
+		}
+		i += size
+	}
+	return s[:i]
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInferManifests(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		a, b        map[string][]byte
+		from, to    Manifest
+		unexplained []string
+	}{
+		"Basic": {
+			a: map[string][]byte{
+				"main.tf": []byte("env = \"production\"\nurl = \"api.example.com\"\nname = \"production_lb\"\n"),
+			},
+			b: map[string][]byte{
+				"main.tf": []byte("env = \"test\"\nurl = \"api.example-int.com\"\nname = \"test_lb\"\n"),
+			},
+			from:        Manifest{"production": "production", "example": "example"},
+			to:          Manifest{"production": "test", "example": "example-int"},
+			unexplained: []string{},
+		},
+		"RenamedFile": {
+			a: map[string][]byte{
+				"main.tf":       []byte("env = \"production\"\n"),
+				"production.tf": []byte("# production only\n"),
+			},
+			b: map[string][]byte{
+				"main.tf": []byte("env = \"test\"\n"),
+				"test.tf": []byte("# test only\n"),
+			},
+			from:        Manifest{"production": "production"},
+			to:          Manifest{"production": "test"},
+			unexplained: []string{},
+		},
+		"Edits": {
+			a: map[string][]byte{
+				"main.tf":  []byte("env = \"production\"\n"),
+				"notes.md": []byte("hello\n"),
+				"old.md":   []byte("old\n"),
+			},
+			b: map[string][]byte{
+				"main.tf":  []byte("env = \"test\"\n"),
+				"notes.md": []byte("hello world\n"),
+				"new.md":   []byte("new\n"),
+			},
+			from:        Manifest{"production": "production"},
+			to:          Manifest{"production": "test"},
+			unexplained: []string{"new.md", "notes.md", "old.md"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			from, to, unexplained, errs := InferManifests(test.a, test.b)
+			if hasErrs(errs...) {
+				t.Errorf("unexpected errors: %v", errs)
+			}
+			if !reflect.DeepEqual(from, test.from) {
+				t.Errorf("source manifest is not as expected: is %v, expected %v", from, test.from)
+			}
+			if !reflect.DeepEqual(to, test.to) {
+				t.Errorf("destination manifest is not as expected: is %v, expected %v", to, test.to)
+			}
+			if !checkSameFields(asMap(keysOf(unexplained)), asMap(test.unexplained)) {
+				t.Errorf("unexplained files are not as expected: is %v, expected %v", unexplained, test.unexplained)
+			}
+		})
+	}
+}
+
+func keysOf(m map[string]string) []string {
+	out := []string{}
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
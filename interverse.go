@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"text/tabwriter"
@@ -12,6 +14,10 @@ import (
 // one alterverse to another alterverse.
 type Interverse struct {
 	lt lookupTable
+	// reversed is true if the Interverse converts from the destination to
+	// the source alterverse. The scopes of the records always refer to the
+	// paths of the source alterverse, see scopePath.
+	reversed bool
 }
 
 // NewInterverse takes two manifests, builds a lookup table, sorts
@@ -19,8 +25,14 @@ type Interverse struct {
 // to ensure proper string substitution) and returns a ready to use
 // Interverse.
 func NewInterverse(from, to Manifest) (*Interverse, error) {
+	return NewInterverseWithOptions(from, to, nil)
+}
+
+// NewInterverseWithOptions works like NewInterverse but additionally takes
+// the options of the manifest keys into account.
+func NewInterverseWithOptions(from, to Manifest, opts Options) (*Interverse, error) {
 	i := &Interverse{}
-	lt, err := newLookupTable(from, to)
+	lt, err := newLookupTable(from, to, opts)
 	// the reverse sort is important: it ensures that long strings are replaced
 	// first so shorter strings which are substrings of the longer ones do not
 	// interfer with those.
@@ -29,19 +41,56 @@ func NewInterverse(from, to Manifest) (*Interverse, error) {
 	return i, err
 }
 
+// Reverse returns an Interverse which converts the data in the opposite
+// direction, from the destination alterverse to the source alterverse.
+func (t Interverse) Reverse() *Interverse {
+	lt := lookupTable{}
+	for _, lr := range t.lt {
+		reversed := *lr
+		reversed.From, reversed.To = lr.To, lr.From
+		lt = append(lt, &reversed)
+	}
+	sort.Sort(sort.Reverse(lt))
+	return &Interverse{lt: lt, reversed: !t.reversed}
+}
+
+// scopePath returns the path the scopes of the records are checked against
+// for the file path passed. If the Interverse is reversed the path is mapped
+// back to the source alterverse first using all records.
+func (t Interverse) scopePath(path string) string {
+	if !t.reversed {
+		return path
+	}
+	tokenizer := NewTokenizer([]byte(path))
+	for _, lr := range t.lt {
+		tokenizer.Tokenize(switchToken{A: lr.From, B: lr.To, Name: lr.Name, match: lr.matcher(lr.From)})
+	}
+	return string(tokenizer.Mutate())
+}
+
 // Deduce performs the actual string substitution using the lookup table.
 // This is done using the Tokenizer. Deduce can produce an alterverse that
 // cannot be converted back to its source alterverse. To avoid this make
-// use of the DeduceStrict method.
+// use of the DeduceStrict method. The substitution is applied to the file
+// paths (the keys of the map) as well as to the file contents.
 func (t Interverse) Deduce(in map[string][]byte) map[string][]byte {
 	out := map[string][]byte{}
 	for k, v := range in {
-		tokenizer := NewTokenizer(v)
-		for _, lr := range t.lt {
-			st := switchToken{A: lr.From, B: lr.To}
-			tokenizer.Tokenize(st)
-		}
-		out[k] = tokenizer.Mutate()
+		path := t.tokenize([]byte(k), k)
+		data := t.tokenize(v, k)
+		out[string(path.Mutate())] = data.Mutate()
+	}
+	return out
+}
+
+// DeducePaths returns a map where the keys are the file paths of the map
+// passed and the values are the file paths as they would be named in the
+// deduced alterverse.
+func (t Interverse) DeducePaths(in map[string][]byte) map[string]string {
+	out := map[string]string{}
+	for k := range in {
+		path := t.tokenize([]byte(k), k)
+		out[k] = string(path.Mutate())
 	}
 	return out
 }
@@ -49,90 +98,237 @@ func (t Interverse) Deduce(in map[string][]byte) map[string][]byte {
 // DeduceStrict performs the actual string substitution using the lookup table.
 // This is done using the Tokenizer. DeduceStrict produces alterverses that
 // can be converted back to its source alterverse but has a huge overhead compared
-// to the Deduce method.
+// to the Deduce method. File paths are checked the same way as the file contents,
+// additionally it is ensured that no two files are deduced to the same path.
 func (t Interverse) DeduceStrict(in map[string][]byte) (map[string][]byte, []error) {
-	tokenizers := map[string]Tokenizer{}
-	for k, v := range in {
-		tokenizer := NewTokenizer(v)
-		for _, lr := range t.lt {
-			st := switchToken{A: lr.From, B: lr.To}
-			tokenizer.Tokenize(st)
-		}
-		tokenizers[k] = tokenizer
+	names := make([]string, 0, len(in))
+	for k := range in {
+		names = append(names, k)
 	}
+	sort.Strings(names)
 
 	out := map[string][]byte{}
-	for k, v := range tokenizers {
-		out[k] = v.Mutate()
+	paths := map[string]string{}
+	errs := []error{}
+	for _, k := range names {
+		path, pathErrs := t.deduceStrict([]byte(k), k, fmt.Sprintf("path of file '%s'", k))
+		errs = append(errs, pathErrs...)
+		data, dataErrs := t.deduceStrict(in[k], k, fmt.Sprintf("file '%s'", k))
+		errs = append(errs, dataErrs...)
+
+		paths[k] = string(path)
+		out[string(path)] = data
 	}
+	errs = append(errs, checkPathCollisions(paths)...)
+
+	return out, errs
+}
+
+// deduceStrict substitutes the data passed and ensures that the result can be
+// converted back. Only the records in scope of the file path passed are applied.
+// The description is used to give the errors returned some context.
+func (t Interverse) deduceStrict(in []byte, path, description string) ([]byte, []error) {
+	tokenizer := t.tokenize(in, path)
+	out := tokenizer.Mutate()
 
+	records := t.lt.inScope(t.scopePath(path))
 	errs := []error{}
-	for k, v := range tokenizers {
-		for _, lr := range t.lt {
-			if v.Contains([]byte(lr.To)) {
-				errs = append(errs, fmt.Errorf("file '%s' contains the string '%s' which is "+
-					"the value of the manifest key '%s' of the destination alterverse", k, lr.To, lr.Name))
-			}
+	for _, lr := range records {
+		for _, p := range tokenizer.Find(lr.matcher(lr.To)) {
+			errs = append(errs, newError(CodeDestinationValue, "%s contains the string '%s' at line %d, column %d which is "+
+				"the value of the manifest key '%s' of the destination alterverse", description, lr.To, p.Line, p.Column, lr.Name).
+				inFile(path).forKey(lr.Name).at(p.Line, p.Column))
 		}
 	}
 	if len(errs) > 0 {
 		return out, errs
 	}
 
-	reverse := map[string][]byte{}
-	for k, v := range out {
-		tokenizer := NewTokenizer(v)
-		for _, lr := range t.lt {
-			st := switchToken{A: lr.To, B: lr.From}
-			tokenizer.Tokenize(st)
-		}
-		reverse[k] = tokenizer.Mutate()
+	reverse := NewTokenizer(out)
+	for _, lr := range records {
+		st := switchToken{A: lr.To, B: lr.From, Name: lr.Name, match: lr.matcher(lr.To)}
+		reverse.Tokenize(st)
 	}
-
-	for k := range in {
-		if !bytes.Equal(in[k], reverse[k]) {
-			errs = append(errs, fmt.Errorf("full monty failed for '%s'", k))
-		}
+	if reversed := reverse.Mutate(); !bytes.Equal(in, reversed) {
+		line, column := lineColumn(in, commonPrefix(in, reversed))
+		errs = append(errs, newError(CodeRoundTrip, "full monty failed for %s, the content mapped back differs "+
+			"starting at line %d, column %d:\n%s", description, line, column, unifiedHunks(in, reversed, 0)).
+			inFile(path).at(line, column))
 	}
 
 	return out, errs
 }
 
+// lineColumn returns the one based line and column (counted in bytes) of the
+// offset passed within the data.
+func lineColumn(data []byte, offset int) (int, int) {
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// commonPrefix returns the length of the common prefix of a and b.
+func commonPrefix(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// tokenize returns a Tokenizer which has all records of the lookup table in
+// scope of the file path passed applied to the data passed.
+func (t Interverse) tokenize(in []byte, path string) Tokenizer {
+	tokenizer := NewTokenizer(in)
+	for _, lr := range t.lt.inScope(t.scopePath(path)) {
+		st := switchToken{A: lr.From, B: lr.To, Name: lr.Name, match: lr.matcher(lr.From)}
+		tokenizer.Tokenize(st)
+	}
+	return tokenizer
+}
+
+// checkPathCollisions takes a map of source paths to their deduced paths and
+// returns an error for every deduced path that more than one source path maps to.
+func checkPathCollisions(paths map[string]string) []error {
+	errs := []error{}
+	for to, from := range reverseStringMap(paths) {
+		if len(from) > 1 {
+			errs = append(errs, newError(CodePathCollision, "the files '%s' would all be written to '%s'", strings.Join(from, "', '"), to).inFile(to))
+		}
+	}
+	return errs
+}
+
 type lookupRecord struct {
 	From string
 	To   string
 	Name string
+
+	// Match is the match mode used to find the occurrences of the values,
+	// see KeyOptions for details.
+	Match   string
+	pattern *regexp.Regexp
+	// include and exclude restrict the file paths the record is applied to.
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// inScope checks if the record applies to the file path passed.
+func (lr lookupRecord) inScope(path string) bool {
+	path = filepath.ToSlash(path)
+	if len(lr.include) > 0 && !matchesAny(lr.include, path) {
+		return false
+	}
+	return !matchesAny(lr.exclude, path)
+}
+
+// matcher returns the matcher which finds the occurrences of the value passed
+// according to the match mode of the record.
+func (lr lookupRecord) matcher(value string) matcher {
+	switch lr.Match {
+	case matchWord:
+		return wordMatcher(value)
+	case matchRegex:
+		return regexMatcher{re: lr.pattern, value: []byte(value)}
+	default:
+		return substringMatcher(value)
+	}
 }
 
 type lookupTable []*lookupRecord
 
-func newLookupTable(from, to map[string]string) (lookupTable, error) {
+func newLookupTable(from, to map[string]string, opts Options) (lookupTable, error) {
 	lt := []*lookupRecord{}
 
 	if ok, missing := haveSameKeys(from, to); !ok {
-		return lookupTable(lt), fmt.Errorf("the following keys are missing: %s", strings.Join(missing, ", "))
+		return lookupTable(lt), newError(CodeMissingKey, "the following keys are missing: %s", strings.Join(missing, ", ")).forKey(missing[0])
+	}
+
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		if _, ok := from[k]; !ok {
+			return lookupTable(lt), newError(CodeInvalidOptions, "options are defined for key '%s' which is not present in the manifest", k).forKey(k)
+		}
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
+	records := map[string]*lookupRecord{}
 	for k := range from {
 		if from[k] == "" {
-			return lookupTable(lt), fmt.Errorf("key	'%s' in 'from' manifest must not be empty", k)
+			return lookupTable(lt), newError(CodeUndefinedValue, "key	'%s' in 'from' manifest must not be empty", k).forKey(k)
 		}
 
 		if to[k] == "" {
-			return lookupTable(lt), fmt.Errorf("key	'%s' in 'to' manifest must not be empty", k)
+			return lookupTable(lt), newError(CodeUndefinedValue, "key	'%s' in 'to' manifest must not be empty", k).forKey(k)
+		}
+
+		pattern, err := opts[k].compile()
+		if err != nil {
+			return lookupTable(lt), newError(CodeInvalidOptions, "key '%s': %s", k, err.Error()).forKey(k)
+		}
+		include, err := compileGlobs(opts[k].Include)
+		if err != nil {
+			return lookupTable(lt), newError(CodeInvalidOptions, "key '%s': include pattern could not be compiled: %s", k, err.Error()).forKey(k)
+		}
+		exclude, err := compileGlobs(opts[k].Exclude)
+		if err != nil {
+			return lookupTable(lt), newError(CodeInvalidOptions, "key '%s': exclude pattern could not be compiled: %s", k, err.Error()).forKey(k)
 		}
 
 		lr := &lookupRecord{
-			From: from[k],
-			To:   to[k],
-			Name: k,
+			From:    from[k],
+			To:      to[k],
+			Name:    k,
+			Match:   opts[k].Match,
+			pattern: pattern,
+			include: include,
+			exclude: exclude,
 		}
 		lt = append(lt, lr)
+		records[k] = lr
+	}
+
+	for _, k := range keys {
+		for _, v := range opts[k].Variants {
+			fromVariant, err := variant(v, from[k])
+			if err != nil {
+				return lookupTable(lt), newError(CodeInvalidOptions, "key '%s': %s", k, err.Error()).forKey(k)
+			}
+			toVariant, _ := variant(v, to[k])
+			if fromVariant == "" || toVariant == "" {
+				return lookupTable(lt), newError(CodeInvalidOptions, "variant '%s' of key '%s' is empty", v, k).forKey(k)
+			}
+
+			lr := *records[k]
+			lr.From, lr.To, lr.Name = fromVariant, toVariant, k+":"+v
+			lt, err = lookupTable(lt).addDerived(&lr)
+			if err != nil {
+				return lookupTable(lt), err
+			}
+		}
 	}
 
 	return lookupTable(lt), nil
 }
 
+// addDerived adds the record passed which is derived from another record to the
+// lookup table. If an equal record already exists it is not added again. An
+// error is returned if the record collides with another record.
+func (lt lookupTable) addDerived(lr *lookupRecord) (lookupTable, error) {
+	for _, existing := range lt {
+		sameFrom, sameTo := existing.From == lr.From, existing.To == lr.To
+		if sameFrom && sameTo {
+			return lt, nil
+		} else if sameFrom || sameTo {
+			return lt, newError(CodeValueCollision, "'%s' -> '%s' of '%s' collides with '%s' -> '%s' of '%s'",
+				lr.From, lr.To, lr.Name, existing.From, existing.To, existing.Name).forKey(lr.Name)
+		}
+	}
+	return append(lt, lr), nil
+}
+
 // haveSameKeys checks two maps a and b if all keys present in a are also
 // present in b (not vice versa!). A list of missing keys is returned as second
 // return value.
@@ -149,6 +345,17 @@ func haveSameKeys(a, b map[string]string) (bool, []string) {
 	return true, missing
 }
 
+// inScope returns the records which apply to the file path passed.
+func (lt lookupTable) inScope(path string) lookupTable {
+	out := lookupTable{}
+	for _, lr := range lt {
+		if lr.inScope(path) {
+			out = append(out, lr)
+		}
+	}
+	return out
+}
+
 func (lt lookupTable) Len() int           { return len(lt) }
 func (lt lookupTable) Less(i, j int) bool { return len(lt[i].From) < len(lt[j].From) }
 func (lt lookupTable) Swap(i, j int)      { lt[i], lt[j] = lt[j], lt[i] }
@@ -175,10 +382,16 @@ func NewTokenizer(rawBytes []byte) Tokenizer {
 	return Tokenizer{tokens: []token{byteToken(rawBytes)}}
 }
 
-func (t *Tokenizer) Tokenize(by token) {
+// Tokenize splits all byte tokens at the occurrences found by the switch token
+// passed and inserts the switch token at their place.
+func (t *Tokenizer) Tokenize(by switchToken) {
+	raw := t.Raw()
+	find := by.match.prepare(raw)
 	tmp := []token{}
+	offset := 0
 	for _, token := range t.tokens {
-		tmp = append(tmp, token.tokenize(by)...)
+		tmp = append(tmp, token.tokenize(by, find, offset)...)
+		offset += len(token.raw())
 	}
 	t.tokens = tmp
 }
@@ -199,13 +412,68 @@ func (t *Tokenizer) Mutate() []byte {
 	return out
 }
 
-func (t *Tokenizer) Contains(b []byte) bool {
+// Contains checks if the matcher passed finds an occurrence within the byte
+// tokens of the mutated data.
+func (t *Tokenizer) Contains(m matcher) bool {
+	return len(t.Find(m)) > 0
+}
+
+// Find returns the locations of all occurrences the matcher passed finds
+// within the byte tokens of the mutated data. The locations refer to the raw
+// data, the file and the key of the placements returned are not set.
+func (t *Tokenizer) Find(m matcher) []Placement {
+	find := m.prepare(t.Mutate())
+	offsets := []int{}
+	offset, rawOffset := 0, 0
 	for _, token := range t.tokens {
-		if token.contains(b) {
-			return true
+		n := len(token.mutate())
+		if _, ok := token.(byteToken); ok {
+			for pos := offset; pos < offset+n; {
+				start, end, found := find(pos, offset+n)
+				if !found {
+					break
+				}
+				offsets = append(offsets, rawOffset+start-offset)
+				if end > start {
+					pos = end
+				} else {
+					pos = start + 1
+				}
+			}
 		}
+		offset += n
+		rawOffset += len(token.raw())
+	}
+
+	out := []Placement{}
+	raw := t.Raw()
+	for _, o := range offsets {
+		line, column := lineColumn(raw, o)
+		out = append(out, Placement{Offset: o, Line: line, Column: column})
 	}
-	return false
+	return out
+}
+
+// Placements returns the location of every switch token within the raw data.
+// The file of the placements returned is not set.
+func (t *Tokenizer) Placements() []Placement {
+	out := []Placement{}
+	offset, line, column := 0, 1, 1
+	for _, token := range t.tokens {
+		raw := token.raw()
+		if st, ok := token.(switchToken); ok {
+			out = append(out, Placement{Key: st.Name, Offset: offset, Line: line, Column: column})
+		}
+		for _, b := range raw {
+			if b == '\n' {
+				line, column = line+1, 1
+			} else {
+				column++
+			}
+		}
+		offset += len(raw)
+	}
+	return out
 }
 
 func (t *Tokenizer) Dump() string {
@@ -217,54 +485,57 @@ func (t *Tokenizer) Dump() string {
 }
 
 type token interface {
-	tokenize(token) []token
+	tokenize(by switchToken, find findFunc, offset int) []token
 	raw() []byte
 	kind() string
 	mutate() []byte
-	contains([]byte) bool
 }
 
 type byteToken []byte
 
-func (bt byteToken) tokenize(by token) []token {
-	split := bytes.SplitN(bt, by.raw(), 2)
-
-	noMatch := len(split) == 1
-	endsWithMatch := len(split) == 2 && len(split[0]) > 0 && len(split[1]) == 0
-	startsWithMatch := len(split) == 2 && len(split[0]) == 0 && len(split[1]) > 0
-	innerMatch := len(split) == 2 && len(split[0]) > 0 && len(split[1]) > 0
-	fullMatch := len(split) == 2 && len(split[0]) == 0 && len(split[1]) == 0
-
-	var out []token
-	if noMatch {
-		out = []token{bt}
-	} else if endsWithMatch {
-		out = []token{byteToken(split[0]), by}
-	} else if startsWithMatch {
-		next := byteToken(split[1])
-		out = append([]token{by}, next.tokenize(by)...)
-	} else if innerMatch {
-		next := byteToken(split[1])
-		out = append([]token{byteToken(split[0]), by}, next.tokenize(by)...)
-	} else if fullMatch {
-		out = []token{by}
+// tokenize splits the byte token at every occurrence found. The offset is the
+// position of the byte token within the data the find function was prepared
+// for.
+func (bt byteToken) tokenize(by switchToken, find findFunc, offset int) []token {
+	out := []token{}
+	pos := 0
+	for pos < len(bt) {
+		start, end, ok := find(offset+pos, offset+len(bt))
+		if !ok {
+			break
+		}
+		start, end = start-offset, end-offset
+		if start > pos {
+			out = append(out, bt[pos:start])
+		}
+		out = append(out, by)
+		pos = end
+	}
+	if pos == 0 {
+		return []token{bt}
+	}
+	if pos < len(bt) {
+		out = append(out, bt[pos:])
 	}
-
 	return out
 }
 
-func (bt byteToken) contains(b []byte) bool { return bytes.Contains(bt, b) }
-func (bt byteToken) raw() []byte            { return []byte(bt) }
-func (bt byteToken) mutate() []byte         { return bt.raw() }
-func (bt byteToken) kind() string           { return "byteToken" }
+func (bt byteToken) raw() []byte    { return []byte(bt) }
+func (bt byteToken) mutate() []byte { return bt.raw() }
+func (bt byteToken) kind() string   { return "byteToken" }
 
 type switchToken struct {
 	A string
 	B string
+	// Name is the name of the lookup record the token was created for.
+	Name string
+
+	match matcher
 }
 
-func (st switchToken) tokenize(by token) []token { return []token{st} }
-func (st switchToken) contains(b []byte) bool    { return false }
-func (st switchToken) raw() []byte               { return []byte(st.A) }
-func (st switchToken) mutate() []byte            { return []byte(st.B) }
-func (st switchToken) kind() string              { return "switchToken" }
+func (st switchToken) tokenize(by switchToken, find findFunc, offset int) []token {
+	return []token{st}
+}
+func (st switchToken) raw() []byte    { return []byte(st.A) }
+func (st switchToken) mutate() []byte { return []byte(st.B) }
+func (st switchToken) kind() string   { return "switchToken" }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -172,6 +173,47 @@ All API calles to its production environment (example.com) must be avoided.`),
 		errExpected:       false,
 		strictErrExpected: false,
 	},
+	"PathSubstitution": {
+		manifestFrom: map[string]string{
+			"url": "example.com",
+			"env": "production",
+		},
+		from: map[string][]byte{
+			"production/lb.tf":        []byte("name = \"production_lb\""),
+			"lb.example.com.conf":     []byte("server_name lb.example.com;"),
+			"unchanged/api/README.md": []byte("The API lives at api.example.com."),
+		},
+		manifestTo: map[string]string{
+			"url": "example-int.com",
+			"env": "integration",
+		},
+		to: map[string][]byte{
+			"integration/lb.tf":       []byte("name = \"integration_lb\""),
+			"lb.example-int.com.conf": []byte("server_name lb.example-int.com;"),
+			"unchanged/api/README.md": []byte("The API lives at api.example-int.com."),
+		},
+		errExpected:       false,
+		strictErrExpected: false,
+	},
+	"PathCollision": {
+		manifestFrom: map[string]string{
+			"a": "foo",
+			"b": "bar",
+		},
+		from: map[string][]byte{
+			"foo.txt": []byte("x"),
+			"bar.txt": []byte("x"),
+		},
+		manifestTo: map[string]string{
+			"a": "baz",
+			"b": "baz",
+		},
+		to: map[string][]byte{
+			"baz.txt": []byte("x"),
+		},
+		errExpected:       false,
+		strictErrExpected: true,
+	},
 	"ImpossibleRoundTrip": {
 		manifestFrom: map[string]string{
 			"x": "xx",
@@ -265,6 +307,265 @@ func TestDeduceRoundtrip(t *testing.T) {
 	}
 }
 
+func TestDeduceOptions(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		manifestFrom map[string]string
+		manifestTo   map[string]string
+		opts         Options
+		from         string
+		to           string
+		errExpected  bool
+	}{
+		"Variants": {
+			manifestFrom: map[string]string{"env": "production", "app": "web shop"},
+			manifestTo:   map[string]string{"env": "test", "app": "web store"},
+			opts: Options{
+				"env": {Variants: []string{"upper", "title"}},
+				"app": {Variants: []string{"snake", "kebab", "camel"}},
+			},
+			from: "production PRODUCTION Production web shop web_shop web-shop webShop",
+			to:   "test TEST Test web store web_store web-store webStore",
+		},
+		"RedundantVariant": {
+			manifestFrom: map[string]string{"env": "production"},
+			manifestTo:   map[string]string{"env": "test"},
+			opts:         Options{"env": {Variants: []string{"lower", "snake"}}},
+			from:         "production",
+			to:           "test",
+		},
+		"CollidingVariant": {
+			manifestFrom: map[string]string{"env": "production", "other": "PRODUCTION"},
+			manifestTo:   map[string]string{"env": "test", "other": "integration"},
+			opts:         Options{"env": {Variants: []string{"upper"}}},
+			errExpected:  true,
+		},
+		"CollidingDestinationVariant": {
+			manifestFrom: map[string]string{"env": "Production"},
+			manifestTo:   map[string]string{"env": "test"},
+			opts:         Options{"env": {Variants: []string{"lower"}}},
+			errExpected:  true,
+		},
+		"WordMatch": {
+			manifestFrom: map[string]string{"env": "prod"},
+			manifestTo:   map[string]string{"env": "test"},
+			opts:         Options{"env": {Match: matchWord}},
+			from:         "prod product production prod-lb",
+			to:           "test product production test-lb",
+		},
+		"WordMatchDestinationInSource": {
+			manifestFrom: map[string]string{"env": "prod"},
+			manifestTo:   map[string]string{"env": "test"},
+			opts:         Options{"env": {Match: matchWord}},
+			from:         "prod testing",
+			to:           "test testing",
+		},
+		"RegexMatch": {
+			manifestFrom: map[string]string{"env": "production"},
+			manifestTo:   map[string]string{"env": "test"},
+			opts:         Options{"env": {Match: matchRegex, Pattern: `env = "(\w+)"`}},
+			from:         "env = \"production\"\nname = \"production_lb\"",
+			to:           "env = \"test\"\nname = \"production_lb\"",
+		},
+		"RegexWithoutGroup": {
+			manifestFrom: map[string]string{"env": "production"},
+			manifestTo:   map[string]string{"env": "test"},
+			opts:         Options{"env": {Match: matchRegex, Pattern: `env = "\w+"`}},
+			errExpected:  true,
+		},
+		"UnknownMatch": {
+			manifestFrom: map[string]string{"env": "production"},
+			manifestTo:   map[string]string{"env": "test"},
+			opts:         Options{"env": {Match: "fuzzy"}},
+			errExpected:  true,
+		},
+		"UnknownKey": {
+			manifestFrom: map[string]string{"env": "production"},
+			manifestTo:   map[string]string{"env": "test"},
+			opts:         Options{"url": {Variants: []string{"upper"}}},
+			errExpected:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			i, err := NewInterverseWithOptions(test.manifestFrom, test.manifestTo, test.opts)
+			if err != nil && !test.errExpected {
+				t.Errorf("could not create interverse, error was: %s", err.Error())
+				return
+			} else if err == nil && test.errExpected {
+				t.Errorf("could create interverse but error expected")
+				return
+			} else if err != nil {
+				return
+			}
+
+			r, errs := i.DeduceStrict(map[string][]byte{"file": []byte(test.from)})
+			if hasErrs(errs...) {
+				t.Errorf("could not strict deduce, errors were: %v", errs)
+			}
+			if string(r["file"]) != test.to {
+				t.Errorf("result not as expected:\n--- Expected:\n%s\n--- Deduced:\n%s", test.to, r["file"])
+			}
+		})
+	}
+}
+
+func TestDeduceScope(t *testing.T) {
+	t.Parallel()
+	manifestFrom := map[string]string{"account": "123456789012", "env": "production"}
+	manifestTo := map[string]string{"account": "210987654321", "env": "test"}
+	opts := Options{"account": {Include: []string{"terraform/**"}, Exclude: []string{"**/*.md"}}}
+
+	i, err := NewInterverseWithOptions(manifestFrom, manifestTo, opts)
+	if err != nil {
+		t.Fatalf("could not create interverse, error was: %s", err.Error())
+	}
+
+	tests := map[string]struct {
+		path        string
+		from        string
+		to          string
+		errExpected bool
+	}{
+		"Included": {
+			path: "terraform/main.tf",
+			from: "production 123456789012",
+			to:   "test 210987654321",
+		},
+		"IncludedNested": {
+			path: "terraform/modules/vpc/main.tf",
+			from: "123456789012",
+			to:   "210987654321",
+		},
+		"NotIncluded": {
+			path: "docs/accounts.txt",
+			from: "production 123456789012",
+			to:   "test 123456789012",
+		},
+		"Excluded": {
+			path: "terraform/README.md",
+			from: "production 123456789012",
+			to:   "test 123456789012",
+		},
+		"DestinationValueOutOfScope": {
+			path: "docs/accounts.txt",
+			from: "210987654321",
+			to:   "210987654321",
+		},
+		"DestinationValueInScope": {
+			path:        "terraform/main.tf",
+			from:        "210987654321",
+			errExpected: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, errs := i.DeduceStrict(map[string][]byte{test.path: []byte(test.from)})
+			if hasErrs(errs...) != test.errExpected {
+				t.Errorf("errors are not as expected: errors were %v, expected errors: %t", errs, test.errExpected)
+				return
+			}
+			if test.errExpected {
+				return
+			}
+			if string(r[test.path]) != test.to {
+				t.Errorf("result not as expected:\n--- Expected:\n%s\n--- Deduced:\n%s", test.to, r[test.path])
+			}
+		})
+	}
+}
+
+func TestReverseScope(t *testing.T) {
+	t.Parallel()
+	manifestFrom := map[string]string{"env": "production"}
+	manifestTo := map[string]string{"env": "test"}
+	opts := Options{"env": {Include: []string{"production/**"}}}
+
+	i, err := NewInterverseWithOptions(manifestFrom, manifestTo, opts)
+	if err != nil {
+		t.Fatalf("could not create interverse, error was: %s", err.Error())
+	}
+
+	tests := map[string]struct {
+		in       map[string][]byte
+		expected map[string][]byte
+	}{
+		"InScope": {
+			in:       map[string][]byte{"test/a.txt": []byte("env=test edited")},
+			expected: map[string][]byte{"production/a.txt": []byte("env=production edited")},
+		},
+		"OutOfScope": {
+			in:       map[string][]byte{"docs/a.txt": []byte("env=test")},
+			expected: map[string][]byte{"docs/a.txt": []byte("env=test")},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, errs := i.Reverse().DeduceStrict(test.in)
+			if hasErrs(errs...) {
+				t.Fatalf("has unexpected errors, errors are: %v", errs)
+			}
+			if !reflect.DeepEqual(r, test.expected) {
+				t.Errorf("result not as expected: is %q, expected %q", r, test.expected)
+			}
+		})
+	}
+}
+
+func TestDeduceStrictErrorLocations(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		manifestFrom map[string]string
+		manifestTo   map[string]string
+		in           string
+		expected     []Error
+		diff         string
+	}{
+		"DestinationValue": {
+			manifestFrom: map[string]string{"env": "production"},
+			manifestTo:   map[string]string{"env": "test"},
+			in:           "env=production\n# test against test\n",
+			expected: []Error{
+				{Code: CodeDestinationValue, File: "file", Key: "env", Line: 2, Column: 3},
+				{Code: CodeDestinationValue, File: "file", Key: "env", Line: 2, Column: 16},
+			},
+		},
+		"RoundTrip": {
+			manifestFrom: map[string]string{"a": "ab", "b": "c"},
+			manifestTo:   map[string]string{"a": "x", "b": "xb"},
+			in:           "line1\nab c\n",
+			expected:     []Error{{Code: CodeRoundTrip, File: "file", Line: 2, Column: 4}},
+			diff:         "@@ -2 +2 @@\n-ab c\n+ab abb\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			i, err := NewInterverse(test.manifestFrom, test.manifestTo)
+			if err != nil {
+				t.Fatalf("could not create interverse, error was: %s", err.Error())
+			}
+			_, errs := i.DeduceStrict(map[string][]byte{"file": []byte(test.in)})
+			if len(errs) != len(test.expected) {
+				t.Fatalf("number of errors is not as expected: is %d, expected %d, errors are: %v", len(errs), len(test.expected), errs)
+			}
+			for n, err := range errs {
+				e := asError(err)
+				if !strings.HasSuffix(e.Message, test.diff) {
+					t.Errorf("message does not end with the diff expected: is %s, expected %s", e.Message, test.diff)
+				}
+				e.Message = ""
+				if *e != test.expected[n] {
+					t.Errorf("error is not as expected: is %v, expected %v", *e, test.expected[n])
+				}
+			}
+		})
+	}
+}
+
 func TestDeduceRoundtripFuzz(t *testing.T) {
 	t.Parallel()
 	type Test struct {
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+)
+
+const (
+	keepBeginMarker = "omniverse:keep begin"
+	keepEndMarker   = "omniverse:keep end"
+
+	// keepContextLines is the maximum number of lines before and after a kept
+	// region used to find the position of the region in the deduced file.
+	keepContextLines = 3
+)
+
+var keepBeginRegexp = regexp.MustCompile(regexp.QuoteMeta(keepBeginMarker) + `(?: ([0-9a-f]{8}))?`)
+
+// keptRegion is a part of a destination file which is enclosed in keep markers.
+// Such a region is preserved when the file is deduced.
+type keptRegion struct {
+	// before and after hold the lines surrounding the region. They are used
+	// to find the position of the region in the deduced file.
+	before [][]byte
+	after  [][]byte
+	// lines contains the lines of the region including the markers.
+	lines [][]byte
+	// hash is the hash of the deduced content the region replaced the last
+	// time it was applied. It is empty if the region was never applied.
+	hash string
+	// line is the line number of the begin marker.
+	line int
+}
+
+// applyKeptRegions takes the files currently present in the destination and
+// re-applies all kept regions found in them to the deduced files. The renames
+// map the source paths to the deduced paths and are used to find the current
+// version of renamed files. Conflicts are returned as errors.
+func applyKeptRegions(current, deduced map[string][]byte, renames map[string]string) (map[string][]byte, []error) {
+	oldNames := map[string]string{}
+	for oldName, newName := range renames {
+		if _, ok := current[newName]; !ok {
+			oldNames[newName] = oldName
+		}
+	}
+
+	out := map[string][]byte{}
+	errs := []error{}
+	for name, data := range deduced {
+		out[name] = data
+
+		currentName := name
+		if oldName, ok := oldNames[name]; ok {
+			currentName = oldName
+		}
+		currentData, ok := current[currentName]
+		if !ok || !bytes.Contains(currentData, []byte(keepBeginMarker)) {
+			continue
+		}
+
+		regions, err := parseKeptRegions(currentData)
+		if err != nil {
+			errs = append(errs, newError(CodeKeptRegion, "file '%s' in destination: %s", currentName, err.Error()).inFile(currentName))
+			continue
+		}
+		kept, err := keepRegions(data, regions)
+		if err != nil {
+			errs = append(errs, newError(CodeKeptRegion, "file '%s' in destination: %s", currentName, err.Error()).inFile(currentName))
+			continue
+		}
+		out[name] = kept
+	}
+	return out, errs
+}
+
+// parseKeptRegions returns all kept regions of the data passed.
+func parseKeptRegions(data []byte) ([]keptRegion, error) {
+	lines := splitLines(data)
+	regions := []keptRegion{}
+	lastEnd := 0
+	for i := 0; i < len(lines); i++ {
+		if bytes.Contains(lines[i], []byte(keepEndMarker)) {
+			return nil, fmt.Errorf("line %d: '%s' without preceding '%s'", i+1, keepEndMarker, keepBeginMarker)
+		}
+		if !bytes.Contains(lines[i], []byte(keepBeginMarker)) {
+			continue
+		}
+
+		begin := i
+		for i++; i < len(lines) && !bytes.Contains(lines[i], []byte(keepEndMarker)); i++ {
+			if bytes.Contains(lines[i], []byte(keepBeginMarker)) {
+				return nil, fmt.Errorf("line %d: kept regions must not be nested", i+1)
+			}
+		}
+		if i == len(lines) {
+			return nil, fmt.Errorf("line %d: '%s' without matching '%s'", begin+1, keepBeginMarker, keepEndMarker)
+		}
+		if len(regions) > 0 && begin == lastEnd {
+			return nil, fmt.Errorf("line %d: kept regions must be separated by at least one line", begin+1)
+		}
+
+		r := keptRegion{lines: lines[begin : i+1], line: begin + 1}
+		if match := keepBeginRegexp.FindSubmatch(lines[begin]); match != nil {
+			r.hash = string(match[1])
+		}
+		from := begin - keepContextLines
+		if from < lastEnd {
+			from = lastEnd
+		}
+		r.before = lines[from:begin]
+		to := i + 1 + keepContextLines
+		for j := i + 1; j < to && j < len(lines); j++ {
+			if bytes.Contains(lines[j], []byte(keepBeginMarker)) {
+				to = j
+			}
+		}
+		if to > len(lines) {
+			to = len(lines)
+		}
+		r.after = lines[i+1 : to]
+
+		regions = append(regions, r)
+		lastEnd = i + 1
+	}
+	return regions, nil
+}
+
+// keepRegions inserts the regions passed into the data passed. The content
+// between the lines surrounding a region is replaced by the region.
+func keepRegions(data []byte, regions []keptRegion) ([]byte, error) {
+	lines := splitLines(data)
+	out := [][]byte{}
+	pos := 0
+	for _, r := range regions {
+		start, err := findBlock(lines, pos, r.before, true)
+		if err != nil {
+			return nil, fmt.Errorf("kept region at line %d: lines before the region %s", r.line, err.Error())
+		}
+		start += len(r.before)
+
+		end := len(lines)
+		if len(r.after) > 0 {
+			end, err = findBlock(lines, start, r.after, false)
+			if err != nil {
+				return nil, fmt.Errorf("kept region at line %d: lines after the region %s", r.line, err.Error())
+			}
+		}
+
+		hash := hashLines(lines[start:end])
+		if r.hash != "" && r.hash != hash {
+			return nil, fmt.Errorf("kept region at line %d: the content it replaces has changed in source", r.line)
+		}
+
+		out = append(out, lines[pos:start]...)
+		begin := keepBeginRegexp.ReplaceAll(r.lines[0], []byte(keepBeginMarker+" "+hash))
+		out = append(out, begin)
+		out = append(out, r.lines[1:]...)
+		pos = end
+	}
+	out = append(out, lines[pos:]...)
+	return bytes.Join(out, nil), nil
+}
+
+// findBlock searches the lines passed for the block starting at line pos and
+// returns the index of the first line of the block. If unique is true the block
+// must occur exactly once. An empty block is found at pos.
+func findBlock(lines [][]byte, pos int, block [][]byte, unique bool) (int, error) {
+	if len(block) == 0 {
+		return pos, nil
+	}
+	found := -1
+	for i := pos; i+len(block) <= len(lines); i++ {
+		match := true
+		for j := range block {
+			if !bytes.Equal(lines[i+j], block[j]) {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if !unique {
+			return i, nil
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("are not unique in the deduced file")
+		}
+		found = i
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("could not be found in the deduced file")
+	}
+	return found, nil
+}
+
+// splitLines splits the data passed after each new line.
+func splitLines(data []byte) [][]byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func hashLines(lines [][]byte) string {
+	sum := sha256.Sum256(bytes.Join(lines, nil))
+	return fmt.Sprintf("%x", sum[:4])
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyKeptRegions(t *testing.T) {
+	t.Parallel()
+	deduced := "a\nb\nc\nd\ne\n"
+	underlying := hashLines(splitLines([]byte("c\n")))
+	tests := map[string]struct {
+		current     string
+		deduced     string
+		expected    string
+		errExpected bool
+	}{
+		"NoRegion": {
+			current:  "a\nx\nc\nd\ne\n",
+			deduced:  deduced,
+			expected: deduced,
+		},
+		"Insertion": {
+			current:  "a\nb\n# omniverse:keep begin\nlocal\n# omniverse:keep end\nc\nd\ne\n",
+			deduced:  deduced,
+			expected: "a\nb\n# omniverse:keep begin " + hashLines(nil) + "\nlocal\n# omniverse:keep end\nc\nd\ne\n",
+		},
+		"Replacement": {
+			current:  "a\nb\n# omniverse:keep begin " + underlying + "\nlocal\n# omniverse:keep end\nd\ne\n",
+			deduced:  "a\nb\nc\nd\ne\nf\n",
+			expected: "a\nb\n# omniverse:keep begin " + underlying + "\nlocal\n# omniverse:keep end\nd\ne\nf\n",
+		},
+		"AtStartAndEnd": {
+			current:  "<!-- omniverse:keep begin -->\nstart\n<!-- omniverse:keep end -->\na\nb\nc\nd\ne\n<!-- omniverse:keep begin -->\nend\n<!-- omniverse:keep end -->\n",
+			deduced:  deduced,
+			expected: "<!-- omniverse:keep begin " + hashLines(nil) + " -->\nstart\n<!-- omniverse:keep end -->\na\nb\nc\nd\ne\n<!-- omniverse:keep begin " + hashLines(nil) + " -->\nend\n<!-- omniverse:keep end -->\n",
+		},
+		"SourceChanged": {
+			current:     "a\nb\n# omniverse:keep begin " + underlying + "\nlocal\n# omniverse:keep end\nd\ne\n",
+			deduced:     "a\nb\nchanged\nd\ne\n",
+			errExpected: true,
+		},
+		"AnchorMissing": {
+			current:     "x\n# omniverse:keep begin\nlocal\n# omniverse:keep end\nd\n",
+			deduced:     deduced,
+			errExpected: true,
+		},
+		"EndMissing": {
+			current:     "a\n# omniverse:keep begin\nlocal\n",
+			deduced:     deduced,
+			errExpected: true,
+		},
+		"Nested": {
+			current:     "a\n# omniverse:keep begin\n# omniverse:keep begin\n# omniverse:keep end\n",
+			deduced:     deduced,
+			errExpected: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			current := map[string][]byte{"file": []byte(test.current)}
+			in := map[string][]byte{"file": []byte(test.deduced)}
+			out, errs := applyKeptRegions(current, in, map[string]string{"file": "file"})
+			if hasErrs(errs...) && !test.errExpected {
+				t.Errorf("has unexpected errors, errors are: %v", errs)
+				return
+			} else if !hasErrs(errs...) && test.errExpected {
+				t.Errorf("errors expected but no errors occurred")
+				return
+			} else if test.errExpected {
+				return
+			}
+			if string(out["file"]) != test.expected {
+				t.Errorf("result not as expected:\n--- Expected:\n%s\n--- Has:\n%s", test.expected, out["file"])
+			}
+
+			// applying the regions again must not change anything
+			again, errs := applyKeptRegions(out, in, map[string]string{"file": "file"})
+			if hasErrs(errs...) {
+				t.Errorf("re-applying has unexpected errors, errors are: %v", errs)
+			}
+			if string(again["file"]) != string(out["file"]) {
+				t.Errorf("re-applying changed the result:\n%s", strings.TrimSpace(string(again["file"])))
+			}
+		})
+	}
+}
+
+func TestApplyKeptRegionsRenamed(t *testing.T) {
+	t.Parallel()
+	current := map[string][]byte{"prod.txt": []byte("a\n# omniverse:keep begin\nlocal\n# omniverse:keep end\n")}
+	deduced := map[string][]byte{"test.txt": []byte("a\n")}
+	out, errs := applyKeptRegions(current, deduced, map[string]string{"prod.txt": "test.txt"})
+	if hasErrs(errs...) {
+		t.Fatalf("has unexpected errors, errors are: %v", errs)
+	}
+	if !strings.Contains(string(out["test.txt"]), "local") {
+		t.Errorf("kept region of renamed file was not applied")
+	}
+}
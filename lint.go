@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+const (
+	checkContexts         = "contexts"
+	checkOverlappingValue = "overlapping_value"
+	checkCommonWord       = "common_word"
+	checkUnusedKey        = "unused_key"
+	checkDeduce           = "deduce"
+)
+
+// lintMaxWords is the number of words listed in the findings of the common
+// word check.
+const lintMaxWords = 5
+
+// Finding is a single issue found while linting an alterverse.
+type Finding struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Key      string `json:"key,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Lint checks the manifest of the alterverse passed against its files. Values
+// that appear in more than maxContexts distinct contexts, values that are part
+// of other values or of words found in the files as well as keys that match
+// nothing are reported as warnings. If a destination alterverse is passed the
+// files are deduced and every error is reported, eg. if a value of the
+// destination is already present in the source. The findings are sorted by
+// severity, check and key.
+func Lint(a *Alterverse, files map[string][]byte, to *Alterverse, maxContexts int) ([]Finding, []error) {
+	findings := []Finding{}
+
+	keys := make([]string, 0, len(a.Manifest))
+	for k := range a.Manifest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value := a.Manifest[k]
+
+		contexts, err := valueContexts(value, files)
+		if err != nil {
+			return findings, []error{err}
+		}
+		if len(contexts) > maxContexts {
+			findings = append(findings, Finding{Severity: severityWarning, Check: checkContexts, Key: k,
+				Message: fmt.Sprintf("value '%s' of key '%s' appears in %d distinct contexts, consider more precise keys", value, k, len(contexts))})
+		}
+
+		for _, other := range keys {
+			if other != k && strings.Contains(a.Manifest[other], value) {
+				findings = append(findings, Finding{Severity: severityWarning, Check: checkOverlappingValue, Key: k,
+					Message: fmt.Sprintf("value '%s' of key '%s' is part of the value '%s' of key '%s'", value, k, a.Manifest[other], other)})
+			}
+		}
+
+		if a.Options[k].Match != "" && a.Options[k].Match != matchSubstring {
+			continue
+		}
+		words := enclosingWords(value, files)
+		if len(words) > 0 {
+			listed := words
+			if len(listed) > lintMaxWords {
+				listed = listed[:lintMaxWords]
+			}
+			message := fmt.Sprintf("value '%s' of key '%s' is part of the words '%s'", value, k, strings.Join(listed, "', '"))
+			if len(words) > len(listed) {
+				message += fmt.Sprintf(" and %d more", len(words)-len(listed))
+			}
+			findings = append(findings, Finding{Severity: severityWarning, Check: checkCommonWord, Key: k,
+				Message: message + ", consider the match mode 'word'"})
+		}
+	}
+
+	if to == nil {
+		to = a
+	}
+	tree, errs := newInterverseTree(a, to)
+	if len(errs) > 0 {
+		return findings, errs
+	}
+	hits := map[string]int{}
+	for _, p := range tree.Placements(files) {
+		hits[p.Key]++
+	}
+	for _, k := range tree.keys() {
+		if hits[k] == 0 {
+			findings = append(findings, Finding{Severity: severityWarning, Check: checkUnusedKey, Key: k,
+				Message: fmt.Sprintf("key '%s' matches nothing", k)})
+		}
+	}
+
+	if to != a {
+		_, errs := tree.DeduceStrict(files)
+		for _, err := range errs {
+			e := asError(err)
+			findings = append(findings, Finding{Severity: severityError, Check: checkDeduce, Key: e.Key,
+				File: e.File, Line: e.Line, Column: e.Column, Message: e.Message})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return findings[i].Severity == severityError
+		}
+		if findings[i].Check != findings[j].Check {
+			return findings[i].Check < findings[j].Check
+		}
+		return findings[i].Key < findings[j].Key
+	})
+	return findings, nil
+}
+
+// valueContexts returns the sorted distinct contexts (eg. 'words') the value
+// passed appears in within the files passed.
+func valueContexts(value string, files map[string][]byte) ([]string, error) {
+	regexStart, regexEnd := `(\b[\w-_\.]*`, `[\w-_\.]*\b*)`
+	re, err := regexp.Compile(fmt.Sprintf("%s%s%s", regexStart, regexp.QuoteMeta(value), regexEnd))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	contexts := []string{}
+	for _, data := range files {
+		for _, m := range re.FindAll(data, -1) {
+			context := string(m)
+			if !seen[context] {
+				seen[context] = true
+				contexts = append(contexts, context)
+			}
+		}
+	}
+	sort.Strings(contexts)
+	return contexts, nil
+}
+
+// enclosingWords returns the sorted distinct words found in the files passed
+// which contain the value but are longer than the value.
+func enclosingWords(value string, files map[string][]byte) []string {
+	re := regexp.MustCompile(`\w*` + regexp.QuoteMeta(value) + `\w*`)
+	seen := map[string]bool{}
+	words := []string{}
+	for _, data := range files {
+		for _, m := range re.FindAll(data, -1) {
+			word := string(m)
+			if word == value || seen[word] {
+				continue
+			}
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	sort.Strings(words)
+	return words
+}
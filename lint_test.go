@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+	files := map[string][]byte{
+		"main.tf": []byte("env = prod\nname = prod-lb\ndb = prod.db\nlabel = product\nregion = eu-west-1\n"),
+	}
+	tests := map[string]struct {
+		manifest    Manifest
+		options     Options
+		destination Manifest
+		findings    map[string]string
+	}{
+		"Clean": {
+			manifest: Manifest{"region": "eu-west-1"},
+			findings: map[string]string{},
+		},
+		"Warnings": {
+			manifest: Manifest{"env": "prod", "db": "prod.db", "unused": "nowhere"},
+			findings: map[string]string{
+				checkContexts + " env":         severityWarning,
+				checkOverlappingValue + " env": severityWarning,
+				checkCommonWord + " env":       severityWarning,
+				checkUnusedKey + " unused":     severityWarning,
+			},
+		},
+		"WordMatch": {
+			manifest: Manifest{"env": "prod"},
+			options:  Options{"env": {Match: matchWord}},
+			findings: map[string]string{
+				checkContexts + " env": severityWarning,
+			},
+		},
+		"DestinationValueInSource": {
+			manifest:    Manifest{"region": "eu-west-1"},
+			destination: Manifest{"region": "prod"},
+			findings: map[string]string{
+				checkDeduce + " region": severityError,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := &Alterverse{Manifest: test.manifest, Options: test.options}
+			var to *Alterverse
+			if test.destination != nil {
+				to = &Alterverse{Manifest: test.destination}
+			}
+			findings, errs := Lint(a, files, to, 3)
+			if hasErrs(errs...) {
+				t.Fatalf("has unexpected errors, errors are: %v", errs)
+			}
+			found := map[string]string{}
+			for _, f := range findings {
+				found[f.Check+" "+f.Key] = f.Severity
+			}
+			for k, severity := range test.findings {
+				if found[k] != severity {
+					t.Errorf("finding '%s' with severity '%s' expected, findings are: %v", k, severity, findings)
+				}
+			}
+			if len(found) != len(test.findings) {
+				t.Errorf("findings are not as expected: is %v, expected %v", found, test.findings)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// findFunc returns the position of the first occurrence within data[start:end]
+// of the data it was prepared for.
+type findFunc func(start, end int) (int, int, bool)
+
+// matcher finds the occurrences of a value.
+type matcher interface {
+	// prepare returns a function which finds the occurrences of the value in
+	// the data passed. The data outside of the range searched is taken into
+	// account as context, eg. to detect word boundaries.
+	prepare(data []byte) findFunc
+}
+
+// substringMatcher finds every occurrence of the value.
+type substringMatcher string
+
+func (m substringMatcher) prepare(data []byte) findFunc {
+	return func(start, end int) (int, int, bool) {
+		i := bytes.Index(data[start:end], []byte(m))
+		if i < 0 || len(m) == 0 {
+			return 0, 0, false
+		}
+		return start + i, start + i + len(m), true
+	}
+}
+
+// wordMatcher finds the occurrences of the value which are not part of a
+// larger word.
+type wordMatcher string
+
+func (m wordMatcher) prepare(data []byte) findFunc {
+	value := []byte(m)
+	first, _ := utf8.DecodeRune(value)
+	last, _ := utf8.DecodeLastRune(value)
+	return func(start, end int) (int, int, bool) {
+		for pos := start; len(value) > 0 && pos < end; {
+			i := bytes.Index(data[pos:end], value)
+			if i < 0 {
+				return 0, 0, false
+			}
+			s, e := pos+i, pos+i+len(value)
+			before, _ := utf8.DecodeLastRune(data[:s])
+			after, _ := utf8.DecodeRune(data[e:])
+			if !(isWordCharacter(first) && s > 0 && isWordCharacter(before)) &&
+				!(isWordCharacter(last) && e < len(data) && isWordCharacter(after)) {
+				return s, e, true
+			}
+			_, size := utf8.DecodeRune(data[s:])
+			pos = s + size
+		}
+		return 0, 0, false
+	}
+}
+
+// regexMatcher finds the occurrences of the value where the value is matched
+// by the first capture group of the regular expression.
+type regexMatcher struct {
+	re    *regexp.Regexp
+	value []byte
+}
+
+func (m regexMatcher) prepare(data []byte) findFunc {
+	matches := [][2]int{}
+	for _, match := range m.re.FindAllSubmatchIndex(data, -1) {
+		if len(match) < 4 || match[2] < 0 || !bytes.Equal(data[match[2]:match[3]], m.value) {
+			continue
+		}
+		matches = append(matches, [2]int{match[2], match[3]})
+	}
+	return func(start, end int) (int, int, bool) {
+		for _, match := range matches {
+			if match[0] >= start && match[1] <= end && match[0] < match[1] {
+				return match[0], match[1], true
+			}
+		}
+		return 0, 0, false
+	}
+}
+
+// isWordCharacter returns true if the rune passed is part of a word.
+func isWordCharacter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
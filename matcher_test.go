@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		m        matcher
+		data     string
+		expected [][2]int
+	}{
+		"Substring": {
+			m:        substringMatcher("prod"),
+			data:     "prod product production",
+			expected: [][2]int{{0, 4}, {5, 9}, {13, 17}},
+		},
+		"Word": {
+			m:        wordMatcher("prod"),
+			data:     "prod product _prod prod-lb (prod)",
+			expected: [][2]int{{0, 4}, {19, 23}, {28, 32}},
+		},
+		"WordWithSeparators": {
+			m:        wordMatcher(".example.com"),
+			data:     "api.example.com www.example.community",
+			expected: [][2]int{{3, 15}},
+		},
+		"Regex": {
+			m:        regexMatcher{re: regexp.MustCompile(`env = "(\w+)"`), value: []byte("prod")},
+			data:     `env = "prod" name = "prod" env = "production" env = "prod"`,
+			expected: [][2]int{{7, 11}, {53, 57}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := []byte(test.data)
+			find := test.m.prepare(data)
+			found := [][2]int{}
+			for pos := 0; pos < len(data); {
+				start, end, ok := find(pos, len(data))
+				if !ok {
+					break
+				}
+				found = append(found, [2]int{start, end})
+				pos = end
+			}
+			if !reflect.DeepEqual(found, test.expected) {
+				t.Errorf("occurrences are not as expected: is %v, expected %v", found, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+)
+
+const (
+	conflictOursMarker   = "<<<<<<< destination\n"
+	conflictSepMarker    = "=======\n"
+	conflictTheirsMarker = ">>>>>>> deduced\n"
+)
+
+// mergeFiles performs a three-way merge for every file deduced. The base files
+// are the files deduced the last time, ours are the files currently present in
+// the destination. The renames map the source paths to the deduced paths and
+// are used to find the current version of renamed files. Files which are not
+// part of the base are not merged. Files added to the destination since the
+// last deduce are kept, files deleted in the destination are not recreated
+// unless they have been changed in the source, which counts as conflict as
+// well as files deleted in the source but changed in the destination. The
+// merged files are returned along with the number of conflicts per file.
+func mergeFiles(base, ours, theirs map[string][]byte, renames map[string]string) (map[string][]byte, map[string]int) {
+	oldNames := map[string]string{}
+	for oldName, newName := range renames {
+		if _, ok := ours[newName]; !ok {
+			oldNames[newName] = oldName
+		}
+	}
+
+	out := map[string][]byte{}
+	conflicts := map[string]int{}
+	merged := map[string]bool{}
+	for name, data := range theirs {
+		out[name] = data
+
+		baseData, ok := base[name]
+		if !ok {
+			continue
+		}
+		currentName := name
+		if oldName, ok := oldNames[name]; ok {
+			currentName = oldName
+		}
+		oursData, ok := ours[currentName]
+		if !ok {
+			// deleted in the destination since the last deduce
+			if bytes.Equal(data, baseData) {
+				delete(out, name)
+			} else {
+				conflicts[name] = 1
+			}
+			continue
+		}
+		merged[currentName] = true
+
+		data, n := merge3(baseData, oursData, data)
+		out[name] = data
+		if n > 0 {
+			conflicts[name] = n
+		}
+	}
+
+	for name, data := range ours {
+		if _, ok := out[name]; ok || merged[name] {
+			continue
+		}
+		baseData, ok := base[name]
+		if !ok {
+			// added in the destination since the last deduce
+			out[name] = data
+		} else if !bytes.Equal(data, baseData) {
+			// deleted in the source but changed in the destination
+			out[name] = data
+			conflicts[name] = 1
+		}
+	}
+	return out, conflicts
+}
+
+// merge3 performs a line based three-way merge of the changes made in ours and
+// theirs since base. Changes made on both sides that are not equal are written
+// as conflicts enclosed by conflict markers. The merged data is returned along
+// with the number of conflicts.
+func merge3(base, ours, theirs []byte) ([]byte, int) {
+	if bytes.Equal(ours, base) {
+		return theirs, 0
+	}
+	if bytes.Equal(theirs, base) || bytes.Equal(ours, theirs) {
+		return ours, 0
+	}
+
+	baseLines, oursLines, theirsLines := splitLines(base), splitLines(ours), splitLines(theirs)
+	matchOurs, matchTheirs := matchLines(base, ours), matchLines(base, theirs)
+
+	out := [][]byte{}
+	conflicts := 0
+	b, o, t := 0, 0, 0
+	for b < len(baseLines) || o < len(oursLines) || t < len(theirsLines) {
+		// emit lines which are unchanged on both sides
+		stable := 0
+		for b+stable < len(baseLines) && matchOurs[b+stable] == o+stable && matchTheirs[b+stable] == t+stable {
+			stable++
+		}
+		if stable > 0 {
+			out = append(out, baseLines[b:b+stable]...)
+			b, o, t = b+stable, o+stable, t+stable
+			continue
+		}
+
+		// find the next base line that is present on both sides
+		next := b
+		for next < len(baseLines) && (matchOurs[next] < 0 || matchTheirs[next] < 0) {
+			next++
+		}
+		nextOurs, nextTheirs := len(oursLines), len(theirsLines)
+		if next < len(baseLines) {
+			nextOurs, nextTheirs = matchOurs[next], matchTheirs[next]
+		}
+
+		baseChunk := bytes.Join(baseLines[b:next], nil)
+		oursChunk := bytes.Join(oursLines[o:nextOurs], nil)
+		theirsChunk := bytes.Join(theirsLines[t:nextTheirs], nil)
+		switch {
+		case bytes.Equal(oursChunk, baseChunk):
+			out = append(out, theirsChunk)
+		case bytes.Equal(theirsChunk, baseChunk), bytes.Equal(oursChunk, theirsChunk):
+			out = append(out, oursChunk)
+		default:
+			conflicts++
+			out = append(out, []byte(conflictOursMarker), terminateLine(oursChunk),
+				[]byte(conflictSepMarker), terminateLine(theirsChunk), []byte(conflictTheirsMarker))
+		}
+		b, o, t = next, nextOurs, nextTheirs
+	}
+
+	return bytes.Join(out, nil), conflicts
+}
+
+// terminateLine ensures that the data passed ends with a new line if it is not
+// empty.
+func terminateLine(data []byte) []byte {
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		return append(data, '\n')
+	}
+	return data
+}
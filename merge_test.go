@@ -0,0 +1,150 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		base, ours, theirs string
+		expected           string
+		conflicts          int
+	}{
+		"NoChanges": {
+			base:     "a\nb\nc\n",
+			ours:     "a\nb\nc\n",
+			theirs:   "a\nb\nc\n",
+			expected: "a\nb\nc\n",
+		},
+		"OnlyTheirs": {
+			base:     "a\nb\nc\n",
+			ours:     "a\nb\nc\n",
+			theirs:   "a\nB\nc\n",
+			expected: "a\nB\nc\n",
+		},
+		"OnlyOurs": {
+			base:     "a\nb\nc\n",
+			ours:     "a\nb\nc\nd\n",
+			theirs:   "a\nb\nc\n",
+			expected: "a\nb\nc\nd\n",
+		},
+		"BothDistinct": {
+			base:     "a\nb\nc\nd\ne\n",
+			ours:     "a\nB\nc\nd\ne\n",
+			theirs:   "a\nb\nc\nD\ne\n",
+			expected: "a\nB\nc\nD\ne\n",
+		},
+		"BothSame": {
+			base:     "a\nb\nc\n",
+			ours:     "a\nB\nc\nx\n",
+			theirs:   "a\nB\nc\n",
+			expected: "a\nB\nc\nx\n",
+		},
+		"Conflict": {
+			base:      "a\nb\nc\n",
+			ours:      "a\nours\nc\n",
+			theirs:    "a\ntheirs\nc\n",
+			expected:  "a\n" + conflictOursMarker + "ours\n" + conflictSepMarker + "theirs\n" + conflictTheirsMarker + "c\n",
+			conflicts: 1,
+		},
+		"ConflictWithoutNewLine": {
+			base:      "a\nb",
+			ours:      "a\nours",
+			theirs:    "a\ntheirs",
+			expected:  "a\n" + conflictOursMarker + "ours\n" + conflictSepMarker + "theirs\n" + conflictTheirsMarker,
+			conflicts: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			merged, conflicts := merge3([]byte(test.base), []byte(test.ours), []byte(test.theirs))
+			if string(merged) != test.expected {
+				t.Errorf("result not as expected:\n--- Expected:\n%s\n--- Merged:\n%s", test.expected, merged)
+			}
+			if conflicts != test.conflicts {
+				t.Errorf("expected %d conflicts, has %d", test.conflicts, conflicts)
+			}
+		})
+	}
+}
+
+func TestMergeFiles(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		base, ours, theirs map[string]string
+		renames            map[string]string
+		expected           map[string]string
+		conflicts          map[string]int
+	}{
+		"Merged": {
+			base:     map[string]string{"a": "a\nb\nc\nd\ne\n"},
+			ours:     map[string]string{"a": "a\nB\nc\nd\ne\n"},
+			theirs:   map[string]string{"a": "a\nb\nc\nD\ne\n"},
+			expected: map[string]string{"a": "a\nB\nc\nD\ne\n"},
+		},
+		"AddedInDestination": {
+			base:     map[string]string{"a": "a\n"},
+			ours:     map[string]string{"a": "a\n", "local.txt": "local\n"},
+			theirs:   map[string]string{"a": "A\n"},
+			expected: map[string]string{"a": "A\n", "local.txt": "local\n"},
+		},
+		"DeletedInDestination": {
+			base:     map[string]string{"a": "a\n", "b": "b\n"},
+			ours:     map[string]string{"a": "a\n"},
+			theirs:   map[string]string{"a": "a\n", "b": "b\n"},
+			expected: map[string]string{"a": "a\n"},
+		},
+		"DeletedInDestinationChangedInSource": {
+			base:      map[string]string{"a": "a\n", "b": "b\n"},
+			ours:      map[string]string{"a": "a\n"},
+			theirs:    map[string]string{"a": "a\n", "b": "B\n"},
+			expected:  map[string]string{"a": "a\n", "b": "B\n"},
+			conflicts: map[string]int{"b": 1},
+		},
+		"DeletedInSource": {
+			base:     map[string]string{"a": "a\n", "b": "b\n"},
+			ours:     map[string]string{"a": "a\n", "b": "b\n"},
+			theirs:   map[string]string{"a": "a\n"},
+			expected: map[string]string{"a": "a\n"},
+		},
+		"DeletedInSourceChangedInDestination": {
+			base:      map[string]string{"a": "a\n", "b": "b\n"},
+			ours:      map[string]string{"a": "a\n", "b": "B\n"},
+			theirs:    map[string]string{"a": "a\n"},
+			expected:  map[string]string{"a": "a\n", "b": "B\n"},
+			conflicts: map[string]int{"b": 1},
+		},
+		"Renamed": {
+			base:     map[string]string{"test": "a\nb\nc\n"},
+			ours:     map[string]string{"prod": "a\nb\nC\n"},
+			theirs:   map[string]string{"test": "A\nb\nc\n"},
+			renames:  map[string]string{"prod": "test"},
+			expected: map[string]string{"test": "A\nb\nC\n"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			toBytes := func(in map[string]string) map[string][]byte {
+				out := map[string][]byte{}
+				for k, v := range in {
+					out[k] = []byte(v)
+				}
+				return out
+			}
+			merged, conflicts := mergeFiles(toBytes(test.base), toBytes(test.ours), toBytes(test.theirs), test.renames)
+			if !reflect.DeepEqual(merged, toBytes(test.expected)) {
+				t.Errorf("merged files are not as expected: is %q, expected %q", merged, test.expected)
+			}
+			if test.conflicts == nil {
+				test.conflicts = map[string]int{}
+			}
+			if !reflect.DeepEqual(conflicts, test.conflicts) {
+				t.Errorf("conflicts are not as expected: is %v, expected %v", conflicts, test.conflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Options contains a map of manifest keys to the options configuring how
+// their values are substituted.
+type Options map[string]KeyOptions
+
+const (
+	matchSubstring = "substring"
+	matchWord      = "word"
+	matchRegex     = "regex"
+)
+
+// KeyOptions configures how the value of a single manifest key is substituted.
+type KeyOptions struct {
+	// Variants lists the case variants of the value which are substituted
+	// as well, see caseVariants for the variants available.
+	Variants []string `json:"variants,omitempty" yaml:"variants,omitempty"`
+	// Match is the match mode used to find the value. 'substring' (the
+	// default) matches every occurrence, 'word' only matches occurrences
+	// which are not part of a larger word and 'regex' only matches
+	// occurrences captured by the first capture group of Pattern.
+	Match string `json:"match,omitempty" yaml:"match,omitempty"`
+	// Pattern is the regular expression used in the 'regex' match mode.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// Include and Exclude hold glob patterns of the file paths the value is
+	// substituted in. If Include is empty all paths are included.
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
+// compile checks the match mode of the options and returns the compiled
+// pattern if the 'regex' match mode is used.
+func (o KeyOptions) compile() (*regexp.Regexp, error) {
+	switch o.Match {
+	case "", matchSubstring, matchWord:
+		if o.Pattern != "" {
+			return nil, fmt.Errorf("a pattern is only allowed with match mode '%s'", matchRegex)
+		}
+		return nil, nil
+	case matchRegex:
+		re, err := regexp.Compile(o.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern could not be compiled: %s", err.Error())
+		}
+		if re.NumSubexp() != 1 {
+			return nil, fmt.Errorf("pattern must contain exactly one capture group")
+		}
+		return re, nil
+	default:
+		return nil, fmt.Errorf("unknown match mode '%s', available modes are: %s, %s, %s", o.Match, matchSubstring, matchWord, matchRegex)
+	}
+}
+
+// caseVariants holds all case variants available. Each variant is a function
+// which takes the words of a value and returns the variant of the value.
+var caseVariants = map[string]func(value string, words []string) string{
+	"upper": func(value string, words []string) string { return strings.ToUpper(value) },
+	"lower": func(value string, words []string) string { return strings.ToLower(value) },
+	"title": func(value string, words []string) string { return titleCase(value) },
+	"snake": func(value string, words []string) string { return strings.ToLower(strings.Join(words, "_")) },
+	"kebab": func(value string, words []string) string { return strings.ToLower(strings.Join(words, "-")) },
+	"camel": func(value string, words []string) string {
+		out := ""
+		for i, word := range words {
+			if i == 0 {
+				out += strings.ToLower(word)
+			} else {
+				out += titleCase(word)
+			}
+		}
+		return out
+	},
+}
+
+// mergeOptions combines the options of the source and the destination
+// alterverse. Options defined for the same key must be equal.
+func mergeOptions(from, to Options) (Options, []error) {
+	out := Options{}
+	errs := []error{}
+	for k, o := range from {
+		out[k] = o
+	}
+	for k, o := range to {
+		if existing, ok := out[k]; ok && !reflect.DeepEqual(existing, o) {
+			errs = append(errs, newError(CodeInvalidOptions, "options of key '%s' differ between source and destination alterverse", k).forKey(k))
+			continue
+		}
+		out[k] = o
+	}
+	return out, errs
+}
+
+// variant returns the case variant of the value passed.
+func variant(name, value string) (string, error) {
+	f, ok := caseVariants[name]
+	if !ok {
+		available := make([]string, 0, len(caseVariants))
+		for k := range caseVariants {
+			available = append(available, k)
+		}
+		sort.Strings(available)
+		return "", fmt.Errorf("unknown variant '%s', available variants are: %s", name, strings.Join(available, ", "))
+	}
+	return f(value, splitWords(value)), nil
+}
+
+// splitWords splits the value passed into words. Words are separated by any
+// character which is neither a letter nor a digit as well as by a change from
+// a lower case to an upper case letter.
+func splitWords(value string) []string {
+	words := []string{}
+	current := []rune{}
+	var last rune
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(current) > 0 {
+				words = append(words, string(current))
+			}
+			current, last = []rune{}, r
+			continue
+		}
+		if unicode.IsUpper(r) && unicode.IsLower(last) && len(current) > 0 {
+			words = append(words, string(current))
+			current = []rune{}
+		}
+		current, last = append(current, r), r
+	}
+	if len(current) > 0 {
+		words = append(words, string(current))
+	}
+	return words
+}
+
+// titleCase converts the first letter of every word in the value passed to
+// upper case and all other letters to lower case.
+func titleCase(value string) string {
+	out := []rune{}
+	start := true
+	for _, r := range value {
+		if start {
+			out = append(out, unicode.ToUpper(r))
+		} else {
+			out = append(out, unicode.ToLower(r))
+		}
+		start = !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
+	return string(out)
+}
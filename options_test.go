@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVariant(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		value    string
+		expected map[string]string
+	}{
+		"SingleWord": {
+			value: "production",
+			expected: map[string]string{
+				"upper": "PRODUCTION",
+				"lower": "production",
+				"title": "Production",
+				"snake": "production",
+				"kebab": "production",
+				"camel": "production",
+			},
+		},
+		"MultipleWords": {
+			value: "my-prodApp v2",
+			expected: map[string]string{
+				"upper": "MY-PRODAPP V2",
+				"lower": "my-prodapp v2",
+				"title": "My-Prodapp V2",
+				"snake": "my_prod_app_v2",
+				"kebab": "my-prod-app-v2",
+				"camel": "myProdAppV2",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for v, expected := range test.expected {
+				is, err := variant(v, test.value)
+				if err != nil {
+					t.Errorf("variant '%s' has unexpected error: %s", v, err.Error())
+				}
+				if is != expected {
+					t.Errorf("variant '%s' of '%s' is '%s', expected '%s'", v, test.value, is, expected)
+				}
+			}
+		})
+	}
+
+	if _, err := variant("unknown", "production"); err == nil {
+		t.Errorf("unknown variant should return an error")
+	}
+}
+
+func TestMergeOptions(t *testing.T) {
+	t.Parallel()
+	from := Options{"env": {Variants: []string{"upper"}}}
+	to := Options{"url": {Variants: []string{"lower"}}}
+	merged, errs := mergeOptions(from, to)
+	if hasErrs(errs...) {
+		t.Errorf("has unexpected errors, errors are: %v", errs)
+	}
+	expected := Options{"env": {Variants: []string{"upper"}}, "url": {Variants: []string{"lower"}}}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("merged options are not as expected: is %v, expected %v", merged, expected)
+	}
+
+	_, errs = mergeOptions(from, Options{"env": {Variants: []string{"title"}}})
+	if !hasErrs(errs...) {
+		t.Errorf("differing options should return an error")
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const (
+	patchContextLines = 3
+	devNull           = "/dev/null"
+	defaultFileMode   = os.FileMode(0644)
+	noNewLineMarker   = "\\ No newline at end of file\n"
+)
+
+// Patch compares the files a (the current state) with the files b (the desired
+// state) and returns a unified diff which turns a into b, see DiffFiles for
+// the renames passed. Renamed files are written as the deletion of the old and
+// the creation of the new file. The file names in the headers are prefixed
+// with 'a/' and 'b/' followed by the prefix passed so the patch can be applied
+// using 'git apply' or 'patch -p1'.
+func Patch(a, b map[string][]byte, renames map[string]string, prefix string) string {
+	return patch(a, b, renames, nil, nil, nil, prefix)
+}
+
+// patch works like Patch but additionally takes the permissions of the files a
+// and b. Files missing in the permissions are considered to be regular files
+// which are not executable. Changes of the permissions are written using the
+// extended headers of git. Changes of binary files, files with binary content
+// as well as files of b copied verbatim or skipped according to the binary
+// policies passed, are only marked like git does.
+func patch(a, b map[string][]byte, renames map[string]string, modesA, modesB map[string]os.FileMode, binary map[string]string, prefix string) string {
+	diffs, obsolete, created, renamed := DiffFiles(a, b, renames)
+	for newName, oldName := range renamed {
+		delete(diffs, newName)
+		obsolete[oldName] = a[oldName]
+		created[newName] = b[newName]
+	}
+
+	mode := func(modes map[string]os.FileMode, name string) string {
+		m, ok := modes[name]
+		if !ok {
+			m = defaultFileMode
+		}
+		if m&os.ModeSymlink != 0 {
+			return "120000"
+		}
+		return fmt.Sprintf("100%o", m.Perm())
+	}
+
+	names := []string{}
+	for name, diff := range diffs {
+		if diff != "" || mode(modesA, name) != mode(modesB, name) {
+			names = append(names, name)
+		}
+	}
+	for name := range obsolete {
+		names = append(names, name)
+	}
+	for name := range created {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out bytes.Buffer
+	for _, name := range names {
+		oldData, isOld := a[name]
+		newData, isNew := b[name]
+		if _, ok := obsolete[name]; ok {
+			isNew, newData = false, nil
+		}
+		if _, ok := created[name]; ok {
+			isOld, oldData = false, nil
+		}
+		filename := path.Join(prefix, name)
+
+		fmt.Fprintf(&out, "diff --git a/%s b/%s\n", filename, filename)
+		oldHeader, newHeader := "a/"+filename, "b/"+filename
+		if !isOld {
+			fmt.Fprintf(&out, "new file mode %s\n", mode(modesB, name))
+			oldHeader = devNull
+		}
+		if !isNew {
+			fmt.Fprintf(&out, "deleted file mode %s\n", mode(modesA, name))
+			newHeader = devNull
+		}
+		if isOld && isNew && mode(modesA, name) != mode(modesB, name) {
+			fmt.Fprintf(&out, "old mode %s\nnew mode %s\n", mode(modesA, name), mode(modesB, name))
+		}
+		if bytes.Equal(oldData, newData) {
+			continue
+		}
+		if policy := binary[name]; policy == binaryCopy || policy == binarySkip || isBinary(oldData) || isBinary(newData) {
+			fmt.Fprintf(&out, "Binary files %s and %s differ\n", oldHeader, newHeader)
+			continue
+		}
+		fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldHeader, newHeader)
+		out.WriteString(unifiedHunks(oldData, newData, patchContextLines))
+	}
+	return out.String()
+}
+
+// Patch returns the unified diff of the changes writing the deduction would
+// apply to the destination alterverse, see Patch for details.
+func (d Deduction) Patch(prefix string) string {
+	modesA, modesB := map[string]os.FileMode{}, map[string]os.FileMode{}
+	for name, meta := range d.CurrentMeta {
+		modesA[name] = meta.Mode
+	}
+	for name, meta := range d.DeducedMeta {
+		modesB[name] = meta.Mode
+	}
+	return patch(d.Current, d.Deduced, d.Renames, modesA, modesB, d.Binary, prefix)
+}
+
+// patchLine is a single line of a unified diff along with the line numbers it
+// has in the old and in the new data.
+type patchLine struct {
+	op       diffmatchpatch.Operation
+	data     []byte
+	old, new int
+}
+
+// unifiedHunks returns the hunks of a unified diff which turns a into b, each
+// change is surrounded by the number of context lines passed.
+func unifiedHunks(a, b []byte, context int) string {
+	linesA, linesB := splitLines(a), splitLines(b)
+
+	lines := []patchLine{}
+	indexA, indexB := 0, 0
+	for _, op := range lineDiff(a, b) {
+		for i := 0; i < op.Lines; i++ {
+			switch op.Type {
+			case diffmatchpatch.DiffEqual:
+				lines = append(lines, patchLine{op: op.Type, data: linesA[indexA], old: indexA, new: indexB})
+				indexA++
+				indexB++
+			case diffmatchpatch.DiffDelete:
+				lines = append(lines, patchLine{op: op.Type, data: linesA[indexA], old: indexA, new: indexB})
+				indexA++
+			case diffmatchpatch.DiffInsert:
+				lines = append(lines, patchLine{op: op.Type, data: linesB[indexB], old: indexA, new: indexB})
+				indexB++
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	for start := 0; start < len(lines); {
+		// find the next change and extend the hunk as long as the next
+		// change is close enough to share the context lines
+		first := start
+		for first < len(lines) && lines[first].op == diffmatchpatch.DiffEqual {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		last := first
+		for next := first; next < len(lines); next++ {
+			if lines[next].op == diffmatchpatch.DiffEqual {
+				continue
+			}
+			if next-last > 2*context+1 {
+				break
+			}
+			last = next
+		}
+
+		from, to := first-context, last+context+1
+		if from < start {
+			from = start
+		}
+		if to > len(lines) {
+			to = len(lines)
+		}
+		hunk := lines[from:to]
+
+		countA, countB := 0, 0
+		for _, l := range hunk {
+			if l.op != diffmatchpatch.DiffInsert {
+				countA++
+			}
+			if l.op != diffmatchpatch.DiffDelete {
+				countB++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(hunk[0].old, countA), hunkRange(hunk[0].new, countB))
+		for _, l := range hunk {
+			switch l.op {
+			case diffmatchpatch.DiffEqual:
+				out.WriteByte(' ')
+			case diffmatchpatch.DiffDelete:
+				out.WriteByte('-')
+			case diffmatchpatch.DiffInsert:
+				out.WriteByte('+')
+			}
+			out.Write(l.data)
+			if !bytes.HasSuffix(l.data, []byte("\n")) {
+				out.WriteString("\n" + noNewLineMarker)
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// hunkRange formats the range of a hunk header. Line numbers are one based,
+// an empty range refers to the line before it.
+func hunkRange(index, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", index)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", index+1)
+	}
+	return fmt.Sprintf("%d,%d", index+1, count)
+}
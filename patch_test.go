@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		a, b    map[string][]byte
+		renames map[string]string
+		prefix  string
+		patch   string
+	}{
+		"Unchanged": {
+			a:     map[string][]byte{"a": []byte("a\n")},
+			b:     map[string][]byte{"a": []byte("a\n")},
+			patch: "",
+		},
+		"Changed": {
+			a: map[string][]byte{"a": []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")},
+			b: map[string][]byte{"a": []byte("1\n2\n3\n4\n5\nsix\n7\n8\n9\n10\n")},
+			patch: "diff --git a/a b/a\n--- a/a\n+++ b/a\n" +
+				"@@ -3,7 +3,7 @@\n 3\n 4\n 5\n-6\n+six\n 7\n 8\n 9\n",
+		},
+		"SeparateHunks": {
+			a: map[string][]byte{"a": []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")},
+			b: map[string][]byte{"a": []byte("one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n")},
+			patch: "diff --git a/a b/a\n--- a/a\n+++ b/a\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		"NoNewLine": {
+			a: map[string][]byte{"a": []byte("a")},
+			b: map[string][]byte{"a": []byte("a\n")},
+			patch: "diff --git a/a b/a\n--- a/a\n+++ b/a\n" +
+				"@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+		},
+		"CreatedAndDeleted": {
+			a: map[string][]byte{"old": []byte("old\n")},
+			b: map[string][]byte{"new": []byte("new\n"), "empty": []byte("")},
+			patch: "diff --git a/empty b/empty\nnew file mode 100644\n" +
+				"diff --git a/new b/new\nnew file mode 100644\n--- /dev/null\n+++ b/new\n@@ -0,0 +1 @@\n+new\n" +
+				"diff --git a/old b/old\ndeleted file mode 100644\n--- a/old\n+++ /dev/null\n@@ -1 +0,0 @@\n-old\n",
+		},
+		"Renamed": {
+			a:       map[string][]byte{"prod": []byte("x\n")},
+			b:       map[string][]byte{"test": []byte("x\n")},
+			renames: map[string]string{"prod": "test"},
+			prefix:  "dest",
+			patch: "diff --git a/dest/prod b/dest/prod\ndeleted file mode 100644\n--- a/dest/prod\n+++ /dev/null\n@@ -1 +0,0 @@\n-x\n" +
+				"diff --git a/dest/test b/dest/test\nnew file mode 100644\n--- /dev/null\n+++ b/dest/test\n@@ -0,0 +1 @@\n+x\n",
+		},
+		"Binary": {
+			a: map[string][]byte{"logo.png": []byte("\x89PNG\r\n\x1a\nproduction")},
+			b: map[string][]byte{"logo.png": []byte("\x89PNG\r\n\x1a\ntest"), "new.png": []byte("\x89PNG\r\n\x1a\n")},
+			patch: "diff --git a/logo.png b/logo.png\nBinary files a/logo.png and b/logo.png differ\n" +
+				"diff --git a/new.png b/new.png\nnew file mode 100644\nBinary files /dev/null and b/new.png differ\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			patch := Patch(test.a, test.b, test.renames, test.prefix)
+			if patch != test.patch {
+				t.Errorf("patch is not as expected:\n--- Expected:\n%s\n--- Patch:\n%s", test.patch, patch)
+			}
+		})
+	}
+}
+
+func TestDeductionPatchModes(t *testing.T) {
+	t.Parallel()
+	d := Deduction{
+		Current:     map[string][]byte{"run.sh": []byte("run\n")},
+		Deduced:     map[string][]byte{"run.sh": []byte("run\n"), "new.sh": []byte("new\n")},
+		Renames:     map[string]string{"run.sh": "run.sh", "new.sh": "new.sh"},
+		CurrentMeta: map[string]FileMeta{"run.sh": {Mode: 0644}},
+		DeducedMeta: map[string]FileMeta{"run.sh": {Mode: 0755}, "new.sh": {Mode: 0755}},
+	}
+	expected := "diff --git a/new.sh b/new.sh\nnew file mode 100755\n--- /dev/null\n+++ b/new.sh\n@@ -0,0 +1 @@\n+new\n" +
+		"diff --git a/run.sh b/run.sh\nold mode 100644\nnew mode 100755\n"
+
+	patch := d.Patch("")
+	if patch != expected {
+		t.Errorf("patch is not as expected:\n--- Expected:\n%s\n--- Patch:\n%s", expected, patch)
+	}
+}
+
+func TestDeductionPatchBinary(t *testing.T) {
+	t.Parallel()
+	d := Deduction{
+		Current: map[string][]byte{"data.bin": []byte("production\n")},
+		Deduced: map[string][]byte{"data.bin": []byte("test\n")},
+		Renames: map[string]string{"data.bin": "data.bin"},
+		Binary:  map[string]string{"data.bin": binaryCopy},
+	}
+	expected := "diff --git a/data.bin b/data.bin\nBinary files a/data.bin and b/data.bin differ\n"
+
+	patch := d.Patch("")
+	if patch != expected {
+		t.Errorf("patch is not as expected:\n--- Expected:\n%s\n--- Patch:\n%s", expected, patch)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+const projectFile = "omniverse.yml"
+
+// Project describes a source alterverse and all alterverses deduced from it.
+// The paths are relative to the directory containing the project file.
+type Project struct {
+	Source       string   `json:"source" yaml:"source"`
+	Destinations []string `json:"destinations" yaml:"destinations"`
+	Ignore       *string  `json:"ignore,omitempty" yaml:"ignore,omitempty"`
+
+	location string
+}
+
+// ProjectDeduction holds the deduction of a single destination of a project
+// or the errors that occurred while deducing it.
+type ProjectDeduction struct {
+	Destination string
+	Deduction   *Deduction
+	Errs        []error
+}
+
+// NewProject reads the project file passed and performs the necessary checks.
+func NewProject(path string) (*Project, error) {
+	p := &Project{location: filepath.Dir(path)}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return p, fmt.Errorf("error while reading project file '%s': %s", path, err)
+	}
+	err = yaml.Unmarshal(data, p)
+	if err != nil {
+		return p, fmt.Errorf("error while unmarshalling project file '%s': %s", path, err)
+	}
+
+	if p.Source == "" {
+		return p, fmt.Errorf("project file '%s' does not define a source", path)
+	}
+	if len(p.Destinations) == 0 {
+		return p, fmt.Errorf("project file '%s' does not define any destinations", path)
+	}
+	seen := map[string]bool{p.path(p.Source): true}
+	for _, destination := range p.Destinations {
+		if seen[p.path(destination)] {
+			return p, fmt.Errorf("project file '%s' lists '%s' more than once", path, destination)
+		}
+		seen[p.path(destination)] = true
+	}
+
+	return p, nil
+}
+
+// Deduce reads the source alterverse once and deduces all destinations
+// concurrently. The ignore regexps of the source and the destinations default
+// to the ignore regexp of the project if nil, if the project does not set one
+// either the default regexp is used. An empty regexp ignores nothing. The
+// deductions are returned in the order of the destinations.
+func (p Project) Deduce(sourceIgnore, destinationIgnore *string) ([]*ProjectDeduction, []error) {
+	from, errs := NewAlterverse(p.path(p.Source), p.ignore(sourceIgnore))
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	fromFiles, err := from.Files()
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	toIgnore := p.ignore(destinationIgnore)
+	out := make([]*ProjectDeduction, len(p.Destinations))
+	var wg sync.WaitGroup
+	for i, destination := range p.Destinations {
+		out[i] = &ProjectDeduction{Destination: destination}
+		wg.Add(1)
+		go func(pd *ProjectDeduction) {
+			defer wg.Done()
+			to, errs := NewAlterverse(p.path(pd.Destination), toIgnore)
+			if len(errs) > 0 {
+				pd.Errs = errs
+				return
+			}
+			pd.Deduction, pd.Errs = NewDeduction(from, fromFiles, to)
+		}(out[i])
+	}
+	wg.Wait()
+
+	return out, nil
+}
+
+// ignore returns the ignore regexp passed, if it is nil the one of the project
+// or the default regexp.
+func (p Project) ignore(ignore *string) string {
+	if ignore != nil {
+		return *ignore
+	}
+	if p.Ignore != nil {
+		return *p.Ignore
+	}
+	return defaultIgnore
+}
+
+func (p Project) path(location string) string {
+	if filepath.IsAbs(location) {
+		return location
+	}
+	return filepath.Join(p.location, location)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewProject(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		location    string
+		errExpected bool
+	}{
+		{location: "project_ok", errExpected: false},
+		{location: "project_does_not_exist", errExpected: true},
+		{location: "project_no_source", errExpected: true},
+		{location: "project_duplicate", errExpected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.location, func(t *testing.T) {
+			_, err := NewProject(filepath.Join(testdata, test.location, projectFile))
+			if err != nil && !test.errExpected {
+				t.Errorf("has unexpected error, error is: %s", err.Error())
+			} else if err == nil && test.errExpected {
+				t.Errorf("error expected but no error occurred")
+			}
+		})
+	}
+}
+
+func TestProjectDeduce(t *testing.T) {
+	t.Parallel()
+	p, err := NewProject(filepath.Join(testdata, "project_ok", projectFile))
+	if err != nil {
+		t.Fatalf("could not read project, error was: %s", err.Error())
+	}
+
+	deductions, errs := p.Deduce(nil, nil)
+	if hasErrs(errs...) {
+		t.Fatalf("could not deduce project, errors were: %v", errs)
+	}
+	if len(deductions) != len(p.Destinations) {
+		t.Fatalf("expected %d deductions, got %d", len(p.Destinations), len(deductions))
+	}
+
+	if hasErrs(deductions[0].Errs...) {
+		t.Errorf("deducing '%s' has unexpected errors: %v", deductions[0].Destination, deductions[0].Errs)
+	} else if _, ok := deductions[0].Deduction.Deduced["FileA.txt"]; !ok {
+		t.Errorf("deducing '%s' did not produce the expected file", deductions[0].Destination)
+	}
+	if !hasErrs(deductions[1].Errs...) {
+		t.Errorf("deducing '%s' should fail", deductions[1].Destination)
+	}
+}
+
+func TestProjectDeduceIgnore(t *testing.T) {
+	t.Parallel()
+	empty, other := "", "^other$"
+	tests := map[string]struct {
+		projectIgnore                   *string
+		sourceIgnore, destinationIgnore *string
+		// hidden files of the source and the destination are read
+		sourceHidden, destinationHidden bool
+	}{
+		"Default":               {},
+		"Empty":                 {sourceIgnore: &empty, destinationIgnore: &empty, sourceHidden: true, destinationHidden: true},
+		"ProjectEmpty":          {projectIgnore: &empty, sourceHidden: true, destinationHidden: true},
+		"EmptyOverridesProject": {projectIgnore: &other, sourceIgnore: &empty, destinationIgnore: &empty, sourceHidden: true, destinationHidden: true},
+		"SourceOnly":            {sourceIgnore: &empty, sourceHidden: true},
+		"DestinationOnly":       {destinationIgnore: &empty, destinationHidden: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "omniverse")
+			if err != nil {
+				t.Fatalf("could not create temporary directory, error was: %s", err.Error())
+			}
+			defer os.RemoveAll(dir)
+			for env, files := range map[string]map[string]string{"production": {".hidden": "env=production"}, "test": {".local": "local"}} {
+				files[alterverseFile] = "manifest:\n  env: " + env + "\n"
+				for name, data := range files {
+					path := filepath.Join(dir, env, name)
+					err := os.MkdirAll(filepath.Dir(path), 0755)
+					if err == nil {
+						err = ioutil.WriteFile(path, []byte(data), 0644)
+					}
+					if err != nil {
+						t.Fatalf("could not write file '%s', error was: %s", name, err.Error())
+					}
+				}
+			}
+
+			p := Project{Source: "production", Destinations: []string{"test"}, Ignore: test.projectIgnore, location: dir}
+			deductions, errs := p.Deduce(test.sourceIgnore, test.destinationIgnore)
+			if hasErrs(errs...) {
+				t.Fatalf("could not deduce project, errors were: %v", errs)
+			}
+			if hasErrs(deductions[0].Errs...) {
+				t.Fatalf("could not deduce '%s', errors were: %v", deductions[0].Destination, deductions[0].Errs)
+			}
+			if _, ok := deductions[0].Deduction.Deduced[".hidden"]; ok != test.sourceHidden {
+				t.Errorf("hidden file of the source should be deduced: %t", test.sourceHidden)
+			}
+			if _, ok := deductions[0].Deduction.Current[".local"]; ok != test.destinationHidden {
+				t.Errorf("hidden file of the destination should be read: %t", test.destinationHidden)
+			}
+		})
+	}
+}
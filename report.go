@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const (
+	statusUnchanged = "unchanged"
+	statusChanged   = "changed"
+	statusCreated   = "created"
+	statusDeleted   = "deleted"
+	statusRenamed   = "renamed"
+)
+
+// Report is a machine readable summary of a deduction.
+type Report struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	// InSync is true if writing the deduction would not alter the destination.
+	InSync bool `json:"in_sync"`
+	// Written is true if the deduced files have been written.
+	Written bool         `json:"written"`
+	Files   []FileReport `json:"files"`
+	// Substitutions holds the number of substitutions per manifest key
+	// across all files.
+	Substitutions map[string]int `json:"substitutions"`
+	// Keys holds the substitutions per manifest key, see Deduction.Stats.
+	// It is only set if requested.
+	Keys   []KeyStats `json:"keys,omitempty"`
+	Errors []*Error   `json:"errors"`
+}
+
+// FileReport describes what writing a deduction does to a single file of the
+// destination alterverse.
+type FileReport struct {
+	Path string `json:"path"`
+	// OldPath is the path of a renamed file before it is renamed.
+	OldPath string `json:"old_path,omitempty"`
+	// Status is one of 'unchanged', 'changed', 'created', 'deleted' and
+	// 'renamed'.
+	Status  string `json:"status"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	// Mode describes the change of the permissions, eg. '0644 -> 0755'.
+	Mode string `json:"mode,omitempty"`
+	// Substitutions holds the number of substitutions per manifest key
+	// applied to the path and the content of the file.
+	Substitutions map[string]int `json:"substitutions,omitempty"`
+	// Binary holds the policy applied if the file is binary, see
+	// BinaryRule.
+	Binary string `json:"binary,omitempty"`
+}
+
+// NewReport returns the report of the deduction passed. If any errors are
+// passed the deduction is not evaluated and only the errors are reported.
+func NewReport(source, destination string, d *Deduction, errs []error) *Report {
+	r := &Report{
+		Source:        source,
+		Destination:   destination,
+		Files:         []FileReport{},
+		Substitutions: map[string]int{},
+		Errors:        []*Error{},
+	}
+	for _, err := range errs {
+		if err != nil {
+			r.Errors = append(r.Errors, asError(err))
+		}
+	}
+	if len(r.Errors) > 0 || d == nil {
+		return r
+	}
+
+	substitutions := map[string]map[string]int{}
+	for _, p := range d.Placements {
+		name := d.Renames[p.File]
+		if substitutions[name] == nil {
+			substitutions[name] = map[string]int{}
+		}
+		substitutions[name][p.Key]++
+		r.Substitutions[p.Key]++
+	}
+
+	diffs, obsolete, created, renamed := d.Diff()
+	modes := d.ModeChanges()
+	for name, diff := range diffs {
+		f := FileReport{Path: name, Status: statusUnchanged, Substitutions: substitutions[name], Binary: d.Binary[name]}
+		oldName := name
+		mode, modeChanged := modes[name]
+		if modeChanged {
+			f.Mode = mode.String()
+		}
+		if renamedFrom, ok := renamed[name]; ok {
+			f.Status, f.OldPath, oldName = statusRenamed, renamedFrom, renamedFrom
+		} else if diff != "" || modeChanged {
+			f.Status = statusChanged
+		}
+		f.Added, f.Removed = countLines(d.Current[oldName], d.Deduced[name])
+		r.Files = append(r.Files, f)
+	}
+	for name := range obsolete {
+		f := FileReport{Path: name, Status: statusDeleted}
+		f.Added, f.Removed = countLines(d.Current[name], nil)
+		r.Files = append(r.Files, f)
+	}
+	for name := range created {
+		f := FileReport{Path: name, Status: statusCreated, Substitutions: substitutions[name], Binary: d.Binary[name]}
+		f.Added, f.Removed = countLines(nil, d.Deduced[name])
+		r.Files = append(r.Files, f)
+	}
+	sort.Slice(r.Files, func(i, j int) bool { return r.Files[i].Path < r.Files[j].Path })
+
+	r.InSync = d.InSync()
+	return r
+}
+
+// countLines returns the number of lines added and removed to turn a into b.
+func countLines(a, b []byte) (added, removed int) {
+	for _, op := range lineDiff(a, b) {
+		switch op.Type {
+		case diffmatchpatch.DiffInsert:
+			added += op.Lines
+		case diffmatchpatch.DiffDelete:
+			removed += op.Lines
+		}
+	}
+	return
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNewReport(t *testing.T) {
+	t.Parallel()
+	d := &Deduction{
+		Current: map[string][]byte{"a": []byte("a\nb\n"), "b": []byte("b\n"), "prod": []byte("x\n"), "old": []byte("o\n")},
+		Deduced: map[string][]byte{"a": []byte("a\nc\nd\n"), "b": []byte("b\n"), "test": []byte("x\n"), "new": []byte("n\n")},
+		Renames: map[string]string{"a": "a", "b": "b", "prod": "test", "new": "new"},
+		Placements: []Placement{
+			{File: "a", Key: "env"}, {File: "a", Key: "env"},
+			{File: "prod", Key: "env", Path: true},
+			{File: "new", Key: "env"}, {File: "new", Key: "region"}, {File: "new", Key: "region"}, {File: "new", Key: "region"},
+		},
+	}
+	expected := []FileReport{
+		{Path: "a", Status: statusChanged, Added: 2, Removed: 1, Substitutions: map[string]int{"env": 2}},
+		{Path: "b", Status: statusUnchanged},
+		{Path: "new", Status: statusCreated, Added: 1, Substitutions: map[string]int{"env": 1, "region": 3}},
+		{Path: "old", Status: statusDeleted, Removed: 1},
+		{Path: "test", OldPath: "prod", Status: statusRenamed, Substitutions: map[string]int{"env": 1}},
+	}
+
+	r := NewReport("prod", "test", d, nil)
+	if !reflect.DeepEqual(r.Files, expected) {
+		t.Errorf("files are not as expected: is %v, expected %v", r.Files, expected)
+	}
+	if substitutions := map[string]int{"env": 4, "region": 3}; !reflect.DeepEqual(r.Substitutions, substitutions) {
+		t.Errorf("substitutions are not as expected: is %v, expected %v", r.Substitutions, substitutions)
+	}
+	if r.InSync || len(r.Errors) != 0 {
+		t.Errorf("report should neither be in sync nor have errors: %v", r)
+	}
+
+	r = NewReport("prod", "test", d, []error{newError(CodeRoundTrip, "failed").inFile("a"), fmt.Errorf("other")})
+	errs := []*Error{{Code: CodeRoundTrip, Message: "failed", File: "a"}, {Code: CodeUnknown, Message: "other"}}
+	if !reflect.DeepEqual(r.Errors, errs) {
+		t.Errorf("errors are not as expected: is %v, expected %v", r.Errors, errs)
+	}
+	if len(r.Files) != 0 {
+		t.Errorf("files should not be reported if there are errors, files are: %v", r.Files)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	// stateDir is the directory in the root of an alterverse where omniverse
+	// keeps its state. It is never synced.
+	stateDir = ".omniverse"
+
+	// baseStateDir holds the files as they were deduced the last time.
+	baseStateDir = "base"
+
+	// backupStateDir holds the files of the alterverse as they were before the
+	// last deduce, see Undo. Its subdirectory backupFilesDir holds the files and
+	// backupBaseDir the files deduced the time before.
+	backupStateDir = "backup"
+	backupFilesDir = "files"
+	backupBaseDir  = "base"
+)
+
+// newStateSyncer returns a Syncer for a directory of the state. It ignores
+// nothing, not even the patterns of the ignore files recorded in the state.
+func newStateSyncer(dir string) (*Syncer, error) {
+	s, err := NewSyncer(dir, "")
+	if err != nil {
+		return nil, err
+	}
+	s.ignoreRules = nil
+	return s, nil
+}
+
+// LastDeduced returns the files as they were deduced and written to the
+// alterverse the last time. If the alterverse was never deduced nil is
+// returned.
+func (a Alterverse) LastDeduced() (map[string][]byte, error) {
+	dir := filepath.Join(a.location, stateDir, baseStateDir)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	s, err := newStateSyncer(dir)
+	if err != nil {
+		return nil, err
+	}
+	return s.ReadFiles()
+}
+
+// saveLastDeduced records the files passed as the files deduced the last time.
+func (a Alterverse) saveLastDeduced(files map[string][]byte) error {
+	dir := filepath.Join(a.location, stateDir, baseStateDir)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	s, err := newStateSyncer(dir)
+	if err != nil {
+		return err
+	}
+	return s.WriteFiles(files, true)
+}
+
+// saveBackup records the files and their metadata passed along with the files
+// deduced the last time as the state to restore by Undo. A previous backup is
+// replaced.
+func (a Alterverse) saveBackup(files map[string][]byte, meta map[string]FileMeta) error {
+	dir := filepath.Join(a.location, stateDir, backupStateDir)
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+
+	filesDir := filepath.Join(dir, backupFilesDir)
+	err = os.MkdirAll(filesDir, 0755)
+	if err != nil {
+		return err
+	}
+	s, err := newStateSyncer(filesDir)
+	if err != nil {
+		return err
+	}
+	err = s.writeFilesWithMeta(files, meta, true)
+	if err != nil {
+		return err
+	}
+	err = s.writeMeta(meta, true)
+	if err != nil {
+		return err
+	}
+
+	base, err := a.LastDeduced()
+	if err != nil || base == nil {
+		return err
+	}
+	baseDir := filepath.Join(dir, backupBaseDir)
+	err = os.MkdirAll(baseDir, 0755)
+	if err != nil {
+		return err
+	}
+	s, err = newStateSyncer(baseDir)
+	if err != nil {
+		return err
+	}
+	return s.WriteFiles(base, true)
+}
+
+// Backup returns the files of the alterverse and their metadata as they were
+// before the last deduce. If there is no backup nil is returned.
+func (a Alterverse) Backup() (map[string][]byte, map[string]FileMeta, error) {
+	dir := filepath.Join(a.location, stateDir, backupStateDir, backupFilesDir)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	s, err := newStateSyncer(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := s.ReadFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	meta, err := s.ReadMeta()
+	return files, meta, err
+}
+
+// Undo restores the files of the alterverse as they were before the last
+// deduce as well as the files deduced the time before, which are the base of
+// the next merge. The backup is removed afterwards, thus only the last deduce
+// can be undone.
+func (a Alterverse) Undo() error {
+	files, meta, err := a.Backup()
+	if err != nil {
+		return err
+	}
+	if files == nil {
+		return newError(CodeNoBackup, "there is no backup of '%s' to restore", a.location)
+	}
+
+	err = a.WriteFiles(files, meta)
+	if err != nil {
+		return err
+	}
+	err = a.WriteMeta(meta, true)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(a.location, stateDir, backupStateDir)
+	baseDir := filepath.Join(dir, backupBaseDir)
+	if _, err := os.Stat(baseDir); os.IsNotExist(err) {
+		err = os.RemoveAll(filepath.Join(a.location, stateDir, baseStateDir))
+	} else {
+		var s *Syncer
+		s, err = newStateSyncer(baseDir)
+		if err != nil {
+			return err
+		}
+		var base map[string][]byte
+		base, err = s.ReadFiles()
+		if err != nil {
+			return err
+		}
+		err = a.saveLastDeduced(base)
+	}
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
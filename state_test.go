@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	t.Parallel()
+	dirs := map[string]string{}
+	for _, env := range []string{"production", "test"} {
+		dir, err := ioutil.TempDir("", "omniverse")
+		if err != nil {
+			t.Fatalf("could not create temporary directory, error was: %s", err.Error())
+		}
+		defer os.RemoveAll(dir)
+		err = ioutil.WriteFile(filepath.Join(dir, alterverseFile), []byte("manifest:\n  env: "+env+"\n"), 0644)
+		if err != nil {
+			t.Fatalf("could not write manifest, error was: %s", err.Error())
+		}
+		dirs[env] = dir
+	}
+	err := ioutil.WriteFile(filepath.Join(dirs["production"], "a"), []byte("env=production"), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dirs["test"], "a"), []byte("env=test local"), 0600)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dirs["test"], "stale"), []byte("stale"), 0644)
+	}
+	if err != nil {
+		t.Fatalf("could not write files, error was: %s", err.Error())
+	}
+
+	from, errs := NewAlterverse(dirs["production"], defaultIgnore)
+	if len(errs) > 0 {
+		t.Fatalf("could not create alterverse, errors were: %v", errs)
+	}
+	to, errs := NewAlterverse(dirs["test"], defaultIgnore)
+	if len(errs) > 0 {
+		t.Fatalf("could not create alterverse, errors were: %v", errs)
+	}
+	before, err := to.Files()
+	if err != nil {
+		t.Fatalf("could not read files, error was: %s", err.Error())
+	}
+	files, err := from.Files()
+	if err != nil {
+		t.Fatalf("could not read files, error was: %s", err.Error())
+	}
+
+	err = to.Undo()
+	if err == nil || asError(err).Code != CodeNoBackup {
+		t.Errorf("undo without backup should fail with code %s, error is: %v", CodeNoBackup, err)
+	}
+
+	d, errs := NewDeduction(from, files, to)
+	if len(errs) > 0 {
+		t.Fatalf("could not create deduction, errors were: %v", errs)
+	}
+	err = d.Write()
+	if err != nil {
+		t.Fatalf("could not write deduction, error was: %s", err.Error())
+	}
+	base, err := to.LastDeduced()
+	if err != nil || base == nil {
+		t.Fatalf("base should be recorded, error was: %v", err)
+	}
+
+	err = to.Undo()
+	if err != nil {
+		t.Fatalf("could not undo, error was: %s", err.Error())
+	}
+	after, err := to.Files()
+	if err != nil {
+		t.Fatalf("could not read files, error was: %s", err.Error())
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("files are not restored: is %v, expected %v", after, before)
+	}
+	meta, err := to.Meta()
+	if err != nil {
+		t.Fatalf("could not read metadata, error was: %s", err.Error())
+	}
+	if meta["a"].Mode.Perm() != 0600 {
+		t.Errorf("mode of file 'a' is not restored: is %04o, expected %04o", meta["a"].Mode.Perm(), 0600)
+	}
+	base, err = to.LastDeduced()
+	if err != nil || base != nil {
+		t.Errorf("base should be removed as there was none before, base is %v, error was: %v", base, err)
+	}
+	backup, _, err := to.Backup()
+	if err != nil || backup != nil {
+		t.Errorf("backup should be removed after undo, backup is %v, error was: %v", backup, err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sort"
+)
+
+// Placement is the location of a substitution within the source alterverse.
+// Line and column are one based, the column is counted in bytes.
+type Placement struct {
+	File string `json:"file"`
+	Key  string `json:"key"`
+	// Path is true if the substitution is applied to the path of the file
+	// rather than to its content.
+	Path   bool `json:"path,omitempty"`
+	Offset int  `json:"offset"`
+	Line   int  `json:"line"`
+	Column int  `json:"column"`
+}
+
+// sortPlacements sorts the placements passed by file, path before content
+// and offset.
+func sortPlacements(placements []Placement) {
+	sort.Slice(placements, func(i, j int) bool {
+		a, b := placements[i], placements[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Path != b.Path {
+			return a.Path
+		}
+		return a.Offset < b.Offset
+	})
+}
+
+// KeyStats holds the substitutions of a single manifest key. Variants of a
+// key are listed separately using the name 'key:variant'.
+type KeyStats struct {
+	Key  string `json:"key"`
+	Hits int    `json:"hits"`
+	// Unused is true if the key matched nothing in the source alterverse.
+	Unused     bool        `json:"unused"`
+	Placements []Placement `json:"placements"`
+}
+
+// Stats returns the substitutions of every manifest key sorted by key.
+func (d Deduction) Stats() []KeyStats {
+	placements := map[string][]Placement{}
+	for _, p := range d.Placements {
+		placements[p.Key] = append(placements[p.Key], p)
+	}
+
+	out := []KeyStats{}
+	for _, key := range d.interverse.keys() {
+		ps := placements[key]
+		if ps == nil {
+			ps = []Placement{}
+		}
+		out = append(out, KeyStats{Key: key, Hits: len(ps), Unused: len(ps) == 0, Placements: ps})
+	}
+	return out
+}
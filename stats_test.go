@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlacements(t *testing.T) {
+	t.Parallel()
+	i, err := NewInterverse(Manifest{"env": "production", "region": "eu-west-1"}, Manifest{"env": "test", "region": "us-east-1"})
+	if err != nil {
+		t.Fatalf("could not create interverse, error was: %s", err.Error())
+	}
+	tree := interverseTree{{interverse: i}}
+	files := map[string][]byte{
+		"production/main.tf": []byte("env = production\nregion = eu-west-1 # production\n"),
+		"README":             []byte("nothing to see"),
+	}
+	expected := []Placement{
+		{File: "production/main.tf", Key: "env", Path: true, Offset: 0, Line: 1, Column: 1},
+		{File: "production/main.tf", Key: "env", Offset: 6, Line: 1, Column: 7},
+		{File: "production/main.tf", Key: "region", Offset: 26, Line: 2, Column: 10},
+		{File: "production/main.tf", Key: "env", Offset: 38, Line: 2, Column: 22},
+	}
+
+	placements := tree.Placements(files)
+	if !reflect.DeepEqual(placements, expected) {
+		t.Errorf("placements are not as expected: is %v, expected %v", placements, expected)
+	}
+
+	d := Deduction{Placements: placements, interverse: tree}
+	stats := d.Stats()
+	if len(stats) != 2 || stats[0].Key != "env" || stats[0].Hits != 3 || stats[1].Key != "region" || stats[1].Hits != 1 {
+		t.Errorf("stats are not as expected: %v", stats)
+	}
+
+	d = Deduction{Placements: []Placement{}, interverse: tree}
+	for _, s := range d.Stats() {
+		if !s.Unused || s.Hits != 0 {
+			t.Errorf("key '%s' should be flagged as unused: %v", s.Key, s)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// readSubtrees discovers the manifest files below the root of the alterverse.
+// Directories which are ignored, either by the patterns of the ignore files or
+// by the ignore regexp matching their path, are not searched as their files are
+// never synced. Every manifest found is merged over the manifest of its closest
+// parent, the resulting alterverses are returned by the directory relative to
+// the root.
+func (a *Alterverse) readSubtrees() (map[string]*Alterverse, []error) {
+	dirs := []string{}
+	err := filepath.Walk(a.location, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(a.location, p)
+		if err != nil {
+			return err
+		}
+		rel = normalizePath(rel)
+		if rel != "" && info.IsDir() && (isReserved(rel) || a.isIgnoredDir(rel)) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || info.Name() != alterverseFile || path.Dir(rel) == "." {
+			return nil
+		}
+		dirs = append(dirs, path.Dir(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, []error{newError(CodeInvalidLocation, "error while searching manifest files in '%s': %s", a.location, err)}
+	}
+	// parents are sorted before their children and therefore merged first
+	sort.Strings(dirs)
+
+	subtrees := map[string]*Alterverse{}
+	errs := []error{}
+	for _, dir := range dirs {
+		parent := a.subtree(path.Dir(dir), subtrees)
+		s := &Alterverse{location: filepath.Join(a.location, filepath.FromSlash(dir))}
+		err := readManifestFile(filepath.Join(s.location, alterverseFile), s, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		manifest, options, origins := Manifest{}, Options{}, map[string]string{}
+		for k, v := range parent.Manifest {
+			manifest[k], origins[k] = v, parent.origins[k]
+		}
+		for k, o := range parent.Options {
+			options[k] = o
+		}
+		for k, v := range s.Manifest {
+			manifest[k], origins[k] = v, s.origins[k]
+		}
+		for k, o := range s.Options {
+			options[k] = o
+		}
+		s.Manifest, s.Options, s.origins = manifest, options, origins
+
+		errs = append(errs, s.HasUndefinedValues()...)
+		errs = append(errs, s.HasValueDublicates()...)
+		subtrees[dir] = s
+	}
+	return subtrees, errs
+}
+
+// isIgnoredDir returns true if the directory passed, relative to the root, is
+// ignored by the syncer of the alterverse. The ignore regexp is matched against
+// the directory with a trailing slash, like the paths of the files within it.
+func (a *Alterverse) isIgnoredDir(dir string) bool {
+	if a.syncer == nil {
+		return false
+	}
+	if a.syncer.ignore != nil && a.syncer.ignore.MatchString(dir+"/") {
+		return true
+	}
+	return a.syncer.isIgnored(dir, true)
+}
+
+// subtree returns the alterverse of the closest subtree containing the
+// directory passed. If no subtree contains the directory the alterverse
+// itself is returned.
+func (a *Alterverse) subtree(dir string, subtrees map[string]*Alterverse) *Alterverse {
+	for dir != "." && dir != "/" && dir != "" {
+		if s, ok := subtrees[dir]; ok {
+			return s
+		}
+		dir = path.Dir(dir)
+	}
+	return a
+}
+
+// subtreeInterverse holds the interverse used to deduce the files of a single
+// subtree. The directories are relative to the root of the alterverse, the
+// root itself is the empty string.
+type subtreeInterverse struct {
+	source      string
+	destination string
+	interverse  *Interverse
+}
+
+// contains checks if the file path passed belongs to the subtree.
+func (s subtreeInterverse) contains(file string) bool {
+	file = filepath.ToSlash(file)
+	return s.source == "" || strings.HasPrefix(file, s.source+"/")
+}
+
+// split splits the file path passed into the directory of the subtree and the
+// path relative to it. The directory is deduced by the parent of the subtree,
+// only the relative path is deduced by the interverse of the subtree.
+func (s subtreeInterverse) split(file string) (dir, rel string) {
+	if s.source == "" {
+		return "", file
+	}
+	return s.source + "/", file[len(s.source)+1:]
+}
+
+// join returns the deduced path of a file of the subtree given the deduced
+// path relative to the subtree.
+func (s subtreeInterverse) join(rel string) string {
+	if s.destination == "" {
+		return rel
+	}
+	return s.destination + "/" + rel
+}
+
+// interverseTree holds an interverse for the root and every subtree of the
+// source alterverse which has its own manifest. It is sorted so that nested
+// subtrees precede their parents.
+type interverseTree []subtreeInterverse
+
+// newInterverseTree builds an interverse for the root and every subtree of the
+// source alterverse. The manifest of a subtree in the destination alterverse
+// is looked up in the directory the subtree is deduced to. If it has no
+// manifest there the manifest of its closest parent is used.
+func newInterverseTree(from, to *Alterverse) (interverseTree, []error) {
+	dirs := []string{""}
+	for dir := range from.subtrees {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	tree := interverseTree{}
+	destinations := map[string]bool{}
+	errs := []error{}
+	for _, dir := range dirs {
+		destination := ""
+		if dir != "" {
+			destination = tree.forPath(dir).interverse.DeducePaths(map[string][]byte{dir: nil})[dir]
+			destination = filepath.ToSlash(destination)
+		}
+		destinations[destination] = true
+
+		source, target := from.subtree(dir, from.subtrees), to.subtree(destination, to.subtrees)
+		subtreeErrs := source.MissingKeys(target)
+		if len(subtreeErrs) > 0 {
+			errs = append(errs, subtreeErrs...)
+			continue
+		}
+		opts, subtreeErrs := mergeOptions(source.Options, target.Options)
+		if len(subtreeErrs) > 0 {
+			errs = append(errs, subtreeErrs...)
+			continue
+		}
+		interverse, err := NewInterverseWithOptions(source.Manifest, target.Manifest, opts)
+		if err != nil {
+			if dir != "" {
+				e := asError(err)
+				e.Message = fmt.Sprintf("subtree '%s': %s", dir, e.Message)
+				err = e
+			}
+			errs = append(errs, err)
+			continue
+		}
+		tree = append([]subtreeInterverse{{source: dir, destination: destination, interverse: interverse}}, tree...)
+	}
+
+	for dir := range to.subtrees {
+		if !destinations[dir] {
+			errs = append(errs, newError(CodeOrphanSubtree, "manifest of subtree '%s' in '%s' has no counterpart in '%s'", dir, to.location, from.location).inFile(dir))
+		}
+	}
+	return tree, errs
+}
+
+// forPath returns the interverse of the closest subtree containing the file
+// path passed.
+func (t interverseTree) forPath(file string) subtreeInterverse {
+	for _, s := range t {
+		if s.contains(file) {
+			return s
+		}
+	}
+	return subtreeInterverse{}
+}
+
+// Reverse returns a tree which deduces the files of the destination alterverse
+// back to the source alterverse.
+func (t interverseTree) Reverse() interverseTree {
+	out := interverseTree{}
+	for _, s := range t {
+		out = append(out, subtreeInterverse{source: s.destination, destination: s.source, interverse: s.interverse.Reverse()})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return len(out[i].source) > len(out[j].source) })
+	return out
+}
+
+// DeduceStrict works like Interverse.DeduceStrict but deduces every file using
+// the interverse of its subtree.
+func (t interverseTree) DeduceStrict(in map[string][]byte) (map[string][]byte, []error) {
+	names := make([]string, 0, len(in))
+	for k := range in {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	out := map[string][]byte{}
+	paths := map[string]string{}
+	errs := []error{}
+	for _, k := range names {
+		s := t.forPath(k)
+		_, rel := s.split(k)
+		path, pathErrs := s.interverse.deduceStrict([]byte(rel), k, fmt.Sprintf("path of file '%s'", k))
+		errs = append(errs, pathErrs...)
+		data, dataErrs := s.interverse.deduceStrict(in[k], k, fmt.Sprintf("file '%s'", k))
+		errs = append(errs, dataErrs...)
+
+		paths[k] = s.join(string(path))
+		out[paths[k]] = data
+	}
+	errs = append(errs, checkPathCollisions(paths)...)
+
+	return out, errs
+}
+
+// DeducePaths works like Interverse.DeducePaths but deduces every path using
+// the interverse of its subtree, see subtreeInterverse.split.
+func (t interverseTree) DeducePaths(in map[string][]byte) map[string]string {
+	out := map[string]string{}
+	for k := range in {
+		s := t.forPath(k)
+		_, rel := s.split(k)
+		path := s.interverse.tokenize([]byte(rel), k)
+		out[k] = s.join(string(path.Mutate()))
+	}
+	return out
+}
+
+// Placements returns the placements of all substitutions applied to the paths
+// and the contents of the files passed, sorted by file and offset.
+func (t interverseTree) Placements(in map[string][]byte) []Placement {
+	out := []Placement{}
+	for k, data := range in {
+		s := t.forPath(k)
+		dir, rel := s.split(k)
+		path, content := s.interverse.tokenize([]byte(rel), k), s.interverse.tokenize(data, k)
+		for _, p := range path.Placements() {
+			p.File, p.Path = k, true
+			p.Offset, p.Column = p.Offset+len(dir), p.Column+len(dir)
+			out = append(out, p)
+		}
+		for _, p := range content.Placements() {
+			p.File = k
+			out = append(out, p)
+		}
+	}
+	sortPlacements(out)
+	return out
+}
+
+// keys returns the sorted names of all lookup records of the tree.
+func (t interverseTree) keys() []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, s := range t {
+		for _, lr := range s.interverse.lt {
+			if !seen[lr.Name] {
+				seen[lr.Name] = true
+				out = append(out, lr.Name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
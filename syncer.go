@@ -7,17 +7,26 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
+// gitDir is the directory of a git repository. It is never synced.
+const gitDir = ".git"
+
 // Syncer allows read and write from a certain directory
 type Syncer struct {
 	basedir string
-	ignore  *regexp.Regexp
+	// ignore is nil if no ignore regexp is configured.
+	ignore *regexp.Regexp
+	// ignoreRules holds the patterns of the ignore files found in the
+	// basedir, see readIgnoreRules.
+	ignoreRules ignoreRules
 }
 
-// NewSyncer takes a path to its basedir, a list of ignored files as well a
-// string channel for logging reasons. It returns a Syncer and and (if
-// adequate) an error.
+// NewSyncer takes a path to its basedir and a regexp of ignored files. An empty
+// regexp ignores nothing. Additionally the gitignore-style files '.gitignore' and
+// '.alterverseignore' of the basedir and its subdirectories are respected. It
+// returns a Syncer and and (if adequate) an error.
 func NewSyncer(basedir, ignored string) (*Syncer, error) {
 	abs, err := filepath.Abs(basedir)
 	if err != nil {
@@ -25,21 +34,30 @@ func NewSyncer(basedir, ignored string) (*Syncer, error) {
 	}
 	f, err := os.Stat(abs)
 	if os.IsNotExist(err) {
-		return nil, fmt.Errorf("base directory '%s' does not exist", basedir)
+		return nil, newError(CodeInvalidLocation, "base directory '%s' does not exist", basedir)
 	} else if !f.IsDir() {
-		return nil, fmt.Errorf("base directory '%s' seems to be a file", basedir)
+		return nil, newError(CodeInvalidLocation, "base directory '%s' seems to be a file", basedir)
 	} else if err != nil {
 		return nil, err
 	}
 
-	re, err := regexp.Compile(ignored)
+	var re *regexp.Regexp
+	if ignored != "" {
+		re, err = regexp.Compile(ignored)
+		if err != nil {
+			return nil, newError(CodeInvalidIgnore, "ignore pattern could not be compiled: %s", err.Error())
+		}
+	}
+
+	rules, err := readIgnoreRules(abs)
 	if err != nil {
 		return nil, err
 	}
 
 	s := &Syncer{
-		basedir: abs,
-		ignore:  re,
+		basedir:     abs,
+		ignore:      re,
+		ignoreRules: rules,
 	}
 
 	return s, nil
@@ -47,38 +65,49 @@ func NewSyncer(basedir, ignored string) (*Syncer, error) {
 
 func (s Syncer) listFiles() (map[string][]byte, error) {
 	list := map[string][]byte{}
-
-	err := filepath.Walk(s.basedir, func(path string, info os.FileInfo, err error) error {
-		path = strings.TrimPrefix(path, s.basedir)
-		path = strings.TrimPrefix(path, "/")
-		path = strings.TrimPrefix(path, "\\")
-
-		if info.IsDir() || s.isIgnored(path) {
-			return nil
-		}
-
-		list[path] = nil
+	err := s.walk(func(rel, path string, info os.FileInfo) error {
+		list[rel] = nil
 		return nil
 	})
 	return list, err
 }
 
-func (s Syncer) isIgnored(path string) bool {
-	return s.ignore.MatchString(path)
+// isIgnored returns true if the path passed, relative to the basedir, is
+// ignored. Paths are normalized before matching, thus the ignore regexp as well
+// as the patterns of the ignore files always see slash separated paths relative
+// to the basedir, no matter if files are read, listed, written or deleted. The
+// ignore regexp only applies to files, directories are ignored by the patterns
+// of the ignore files only.
+func (s Syncer) isIgnored(path string, isDir bool) bool {
+	rel := normalizePath(path)
+	if !isDir && s.ignore != nil && s.ignore.MatchString(rel) {
+		return true
+	}
+	return s.ignoreRules.ignored(rel, isDir)
 }
 
-func (s Syncer) deleteFiles(del map[string][]byte) error {
-	for file := range del {
-		if s.isIgnored(file) {
-			continue
-		}
-		path := filepath.Join(s.basedir, file)
-		err := os.Remove(path)
-		if err != nil {
-			return err
+// normalizePath returns the relative path passed cleaned and slash separated.
+func normalizePath(path string) string {
+	rel := filepath.ToSlash(filepath.Clean(path))
+	if rel == "." {
+		return ""
+	}
+	return strings.TrimPrefix(rel, "./")
+}
+
+// isReserved returns true if the relative path passed belongs to the state
+// directory of omniverse or to a git repository or is a manifest file. Such
+// paths are never synced.
+func isReserved(path string) bool {
+	if filepath.Base(path) == alterverseFile {
+		return true
+	}
+	for _, dir := range []string{stateDir, gitDir} {
+		if path == dir || strings.HasPrefix(path, dir+"/") || strings.HasPrefix(path, dir+"\\") {
+			return true
 		}
 	}
-	return nil
+	return false
 }
 
 // WriteFiles writes the files passed to the function as a map where
@@ -88,26 +117,50 @@ func (s Syncer) deleteFiles(del map[string][]byte) error {
 // The del option configures if files that are absent in the map passed
 // but present on the file system should be deleted.
 func (s Syncer) WriteFiles(files map[string][]byte, del bool) error {
+	return s.writeFilesWithMeta(files, nil, del)
+}
+
+// writeFilesWithMeta works like WriteFiles but additionally takes the metadata
+// of the files. Files whose metadata mark them as symbolic link are written as
+// symbolic links pointing to the content of the file.
+func (s Syncer) writeFilesWithMeta(files map[string][]byte, meta map[string]FileMeta, del bool) error {
+	obsolete := map[string][]byte{}
 	if del {
 		haveFiles, err := s.listFiles()
 		if err != nil {
 			return fmt.Errorf("failed while listing files in '%s', error is: %s", s.basedir, err.Error())
 		}
+		_, obsolete, _ = findCommonFiles(haveFiles, files)
+	}
+	return s.updateFiles(files, meta, obsolete)
+}
 
-		_, obsolete, _ := findCommonFiles(haveFiles, files)
-
-		if len(obsolete) > 0 {
-			s.deleteFiles(obsolete)
-		}
+// updateFiles writes the files passed and deletes the files listed in del in a
+// single transaction, either all changes are applied or none. Ignored and
+// reserved files are neither written nor deleted.
+func (s Syncer) updateFiles(files map[string][]byte, meta map[string]FileMeta, del map[string][]byte) error {
+	t, err := newTransaction(s.basedir)
+	if err != nil {
+		return fmt.Errorf("failed preparing the write of '%s', error is: %s", s.basedir, err.Error())
 	}
+	defer t.close()
 
 	for name, data := range files {
-		err := s.writeFile(name, data)
+		if s.isIgnored(name, false) || isReserved(name) {
+			continue
+		}
+		err := t.write(name, data, meta[name].IsSymlink())
 		if err != nil {
-			return fmt.Errorf("failed writing file '%s', error is: %s", name, err.Error())
+			return fmt.Errorf("failed staging file '%s', error is: %s", name, err.Error())
 		}
 	}
-	return nil
+	for name := range del {
+		if s.isIgnored(name, false) || isReserved(name) {
+			continue
+		}
+		t.delete(name)
+	}
+	return t.commit()
 }
 
 func findCommonFiles(a, b map[string][]byte) (common, onlyA, onlyB map[string][]byte) {
@@ -131,84 +184,115 @@ func findCommonFiles(a, b map[string][]byte) (common, onlyA, onlyB map[string][]
 	return
 }
 
-func (s Syncer) writeFile(name string, data []byte) error {
-	if s.isIgnored(name) {
-		return nil
-	}
-
-	path := filepath.Join(s.basedir, name)
-	//log.Info(fmt.Sprintf("Writing file '%s'...", path))
-
-	dir := filepath.Dir(path)
-	_, err := os.Stat(dir)
-	if os.IsNotExist(err) {
-		err = os.MkdirAll(dir, 0755)
-		if err != nil {
-			return err
+// ReadFiles returns the files in the basedir of the Syncer as a map.
+// The keys of the map are the relative file paths, the value is the
+// actual content of the files as a byte slice. Symbolic links are not
+// followed, their content is the target they point to.
+func (s Syncer) ReadFiles() (map[string][]byte, error) {
+	out := map[string][]byte{}
+	err := s.walk(func(rel, path string, info os.FileInfo) error {
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("could not read link '%s', error was: %s", path, err.Error())
+			}
+			out[rel] = []byte(target)
+			return nil
 		}
-	}
 
-	var file *os.File
-	_, err = os.Stat(path)
-	if os.IsNotExist(err) {
-		file, err = os.Create(path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-	} else if err != nil {
-		return err
-	} else {
-		file, err = os.OpenFile(path, os.O_RDWR, 0644)
+		data, err := ioutil.ReadFile(path)
 		if err != nil {
-			return err
+			return fmt.Errorf("could not read file '%s', error was: %s", path, err.Error())
 		}
-		defer file.Close()
-	}
 
-	fileLen, err := file.Write(data)
-	if err != nil {
-		return err
-	}
+		out[rel] = data
+		return nil
+	})
 
-	err = os.Truncate(path, int64(fileLen))
-	if err != nil {
-		return err
-	}
+	return out, err
+}
 
-	err = file.Sync()
-	if err != nil {
-		return err
-	}
+// ReadMeta returns the metadata of the files in the basedir of the Syncer.
+// The keys of the map are the relative file paths as returned by ReadFiles.
+func (s Syncer) ReadMeta() (map[string]FileMeta, error) {
+	out := map[string]FileMeta{}
+	err := s.walk(func(rel, path string, info os.FileInfo) error {
+		out[rel] = FileMeta{Mode: info.Mode() & (os.ModePerm | os.ModeSymlink), ModTime: info.ModTime()}
+		return nil
+	})
 
-	return nil
+	return out, err
 }
 
-// ReadFiles returns the files in the basedir of the Syncer as a map.
-// The keys of the map are the relative file paths, the value is the
-// actual content of the files as a byte slice.
-func (s Syncer) ReadFiles() (map[string][]byte, error) {
-	out := map[string][]byte{}
-	err := filepath.Walk(s.basedir, func(path string, info os.FileInfo, err error) error {
+// walk calls the function passed for every file in the basedir of the Syncer
+// which is neither reserved nor ignored. The relative path passed to the
+// function is normalized, see normalizePath.
+func (s Syncer) walk(fn func(rel, path string, info os.FileInfo) error) error {
+	return filepath.Walk(s.basedir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return fmt.Errorf("could not read file '%s', error was: %s", path, err.Error())
 		}
 
-		if info.IsDir() || s.isIgnored(path) {
+		rel, err := filepath.Rel(s.basedir, path)
+		if err != nil {
+			return err
+		}
+		rel = normalizePath(rel)
+		if rel == "" {
+			return nil
+		}
+		if isReserved(rel) && info.IsDir() {
+			return filepath.SkipDir
+		} else if isReserved(rel) {
 			return nil
 		}
 
-		data, err := ioutil.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("could not read file '%s', error was: %s", path, err.Error())
+		if info.IsDir() && s.isIgnored(rel, true) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || s.isIgnored(rel, false) {
+			return nil
 		}
 
-		path = strings.TrimPrefix(path, s.basedir)
-		path = strings.TrimPrefix(path, "/")
-		path = strings.TrimPrefix(path, "\\")
-		out[path] = data
-		return nil
+		return fn(rel, path, info)
 	})
+}
 
-	return out, err
+// FileMeta holds the metadata of a file which is carried alongside its
+// content.
+type FileMeta struct {
+	// Mode holds the permission bits of the file and whether it is a
+	// symbolic link.
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// IsSymlink returns true if the file is a symbolic link.
+func (m FileMeta) IsSymlink() bool {
+	return m.Mode&os.ModeSymlink != 0
+}
+
+// writeMeta sets the permissions of the files passed. If modTimes is true the
+// modification times are set as well.
+func (s Syncer) writeMeta(meta map[string]FileMeta, modTimes bool) error {
+	for name, m := range meta {
+		if s.isIgnored(name, false) || isReserved(name) {
+			continue
+		}
+		path := filepath.Join(s.basedir, name)
+		if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSymlink != 0 {
+			// the metadata of symbolic links cannot be set portably
+			continue
+		}
+		if err := os.Chmod(path, m.Mode.Perm()); err != nil {
+			return fmt.Errorf("failed setting mode of file '%s', error is: %s", name, err.Error())
+		}
+		if !modTimes || m.ModTime.IsZero() {
+			continue
+		}
+		if err := os.Chtimes(path, m.ModTime, m.ModTime); err != nil {
+			return fmt.Errorf("failed setting modification time of file '%s', error is: %s", name, err.Error())
+		}
+	}
+	return nil
 }
@@ -2,8 +2,11 @@ package main
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 const testdata = "testdata"
@@ -114,6 +117,177 @@ func TestReadFile(t *testing.T) {
 	}
 }
 
+func TestFileMeta(t *testing.T) {
+	t.Parallel()
+	basepath, err := ioutil.TempDir("", "omniverse")
+	if err != nil {
+		t.Fatalf("could not create temporary directory, error was: %s", err.Error())
+	}
+	defer os.RemoveAll(basepath)
+
+	syncer, err := NewSyncer(basepath, defaultIgnore)
+	if err != nil {
+		t.Fatalf("syncer for '%s' could not be created, error was: %s", basepath, err.Error())
+	}
+	err = syncer.WriteFiles(map[string][]byte{"run.sh": []byte("#!/bin/sh"), "README": []byte("readme")}, false)
+	if err != nil {
+		t.Fatalf("could not write files, error was: %s", err.Error())
+	}
+
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	expected := map[string]FileMeta{
+		"run.sh": {Mode: 0755, ModTime: modTime},
+		"README": {Mode: 0600, ModTime: modTime},
+	}
+	err = syncer.writeMeta(expected, true)
+	if err != nil {
+		t.Fatalf("could not write metadata, error was: %s", err.Error())
+	}
+
+	meta, err := syncer.ReadMeta()
+	if err != nil {
+		t.Fatalf("could not read metadata, error was: %s", err.Error())
+	}
+	for name, m := range expected {
+		if meta[name].Mode != m.Mode {
+			t.Errorf("mode of file '%s' is not as expected: is %04o, expected %04o", name, meta[name].Mode, m.Mode)
+		}
+		if !meta[name].ModTime.Equal(m.ModTime) {
+			t.Errorf("modification time of file '%s' is not as expected: is %s, expected %s", name, meta[name].ModTime, m.ModTime)
+		}
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	t.Parallel()
+	basepath, err := ioutil.TempDir("", "omniverse")
+	if err != nil {
+		t.Fatalf("could not create temporary directory, error was: %s", err.Error())
+	}
+	defer os.RemoveAll(basepath)
+
+	syncer, err := NewSyncer(basepath, defaultIgnore)
+	if err != nil {
+		t.Fatalf("syncer for '%s' could not be created, error was: %s", basepath, err.Error())
+	}
+	files := map[string][]byte{"config/prod.yml": []byte("env: prod"), "current.yml": []byte("config/prod.yml")}
+	meta := map[string]FileMeta{"current.yml": {Mode: os.ModeSymlink | 0777}}
+	err = syncer.writeFilesWithMeta(files, meta, false)
+	if err != nil {
+		t.Fatalf("could not write files, error was: %s", err.Error())
+	}
+
+	read, err := syncer.ReadFiles()
+	if err != nil {
+		t.Fatalf("could not read files, error was: %s", err.Error())
+	}
+	for name, data := range files {
+		if !bytes.Equal(read[name], data) {
+			t.Errorf("content of file '%s' is not as expected: is %s, expected %s", name, read[name], data)
+		}
+	}
+	readMeta, err := syncer.ReadMeta()
+	if err != nil {
+		t.Fatalf("could not read metadata, error was: %s", err.Error())
+	}
+	if !readMeta["current.yml"].IsSymlink() {
+		t.Errorf("file 'current.yml' should be a symbolic link")
+	}
+	if readMeta["config/prod.yml"].IsSymlink() {
+		t.Errorf("file 'config/prod.yml' should not be a symbolic link")
+	}
+
+	// replacing a link by a regular file must not write to the target
+	err = syncer.WriteFiles(map[string][]byte{"current.yml": []byte("env: test")}, false)
+	if err != nil {
+		t.Fatalf("could not write files, error was: %s", err.Error())
+	}
+	read, err = syncer.ReadFiles()
+	if err != nil {
+		t.Fatalf("could not read files, error was: %s", err.Error())
+	}
+	if !bytes.Equal(read["config/prod.yml"], files["config/prod.yml"]) {
+		t.Errorf("target of the link has been written to, content is %s", read["config/prod.yml"])
+	}
+	if !bytes.Equal(read["current.yml"], []byte("env: test")) {
+		t.Errorf("content of file 'current.yml' is not as expected: is %s, expected %s", read["current.yml"], "env: test")
+	}
+}
+
+func TestIgnoreSemantics(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		sourceIgnore, destinationIgnore string
+		// expected is the content of 'sub/a.log' in the destination after
+		// writing, nil if it is deleted.
+		expected []byte
+	}{
+		"NotIgnored":           {sourceIgnore: "", destinationIgnore: "", expected: []byte("source")},
+		"IgnoredInSource":      {sourceIgnore: `^sub/a\.log$`, destinationIgnore: "", expected: nil},
+		"IgnoredInDestination": {sourceIgnore: "", destinationIgnore: `^sub/a\.log$`, expected: []byte("destination")},
+		"IgnoredInBoth":        {sourceIgnore: `^sub/a\.log$`, destinationIgnore: `^sub/a\.log$`, expected: []byte("destination")},
+		"IgnoredByPattern":     {sourceIgnore: `^sub/`, destinationIgnore: `\.log$`, expected: []byte("destination")},
+		"OtherFileIgnored":     {sourceIgnore: `^a\.log$`, destinationIgnore: `^a\.log$`, expected: []byte("source")},
+		"AbsolutePathNotSeen":  {sourceIgnore: "^/", destinationIgnore: "^/", expected: []byte("source")},
+		"BackslashNeverSeen":   {sourceIgnore: `\\`, destinationIgnore: `\\`, expected: []byte("source")},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dirs := map[string]string{}
+			for _, dir := range []string{"source", "destination"} {
+				path, err := ioutil.TempDir("", "omniverse")
+				if err != nil {
+					t.Fatalf("could not create temporary directory, error was: %s", err.Error())
+				}
+				defer os.RemoveAll(path)
+				err = os.MkdirAll(filepath.Join(path, "sub"), 0755)
+				if err == nil {
+					err = ioutil.WriteFile(filepath.Join(path, "sub", "a.log"), []byte(dir), 0644)
+				}
+				if err != nil {
+					t.Fatalf("could not write file, error was: %s", err.Error())
+				}
+				dirs[dir] = path
+			}
+
+			source, err := NewSyncer(dirs["source"], test.sourceIgnore)
+			if err != nil {
+				t.Fatalf("syncer could not be created, error was: %s", err.Error())
+			}
+			destination, err := NewSyncer(dirs["destination"], test.destinationIgnore)
+			if err != nil {
+				t.Fatalf("syncer could not be created, error was: %s", err.Error())
+			}
+			files, err := source.ReadFiles()
+			if err != nil {
+				t.Fatalf("could not read files, error was: %s", err.Error())
+			}
+			listed, err := source.listFiles()
+			if err != nil {
+				t.Fatalf("could not list files, error was: %s", err.Error())
+			}
+			if !checkSameFields(files, listed) {
+				t.Errorf("files read and listed differ: read %v, listed %v", files, listed)
+			}
+			err = destination.WriteFiles(files, true)
+			if err != nil {
+				t.Fatalf("could not write files, error was: %s", err.Error())
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(dirs["destination"], "sub", "a.log"))
+			if os.IsNotExist(err) {
+				data = nil
+			} else if err != nil {
+				t.Fatalf("could not read file, error was: %s", err.Error())
+			}
+			if !bytes.Equal(data, test.expected) {
+				t.Errorf("content of the destination file is not as expected: is %q, expected %q", data, test.expected)
+			}
+		})
+	}
+}
+
 func asMap(in []string) map[string][]byte {
 	out := map[string][]byte{}
 	for _, k := range in {
@@ -0,0 +1 @@
+env=production
@@ -0,0 +1 @@
+env=production account=111111111111
@@ -0,0 +1 @@
+env=production account=222222222222
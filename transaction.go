@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// stagePrefix is the prefix of the directories below the state directory
+	// in which a transaction stages its files.
+	stagePrefix = "stage-"
+	// stageNewDir holds the files to be written, stageOldDir holds the files
+	// replaced or deleted until the transaction is done.
+	stageNewDir = "new"
+	stageOldDir = "old"
+)
+
+// transaction writes and deletes files of a directory all at once. Files to
+// write are staged in a temporary directory on the same file system first and
+// then moved in place by renames. Files replaced or deleted are moved aside,
+// if any step fails every change is rolled back.
+type transaction struct {
+	basedir string
+	dir     string
+
+	writes  []string
+	deletes []string
+	// done records the changes applied to the basedir in order.
+	done []transactionStep
+	// keep is true if the stage must not be removed, see close.
+	keep bool
+}
+
+// transactionStep is a change of a single file applied to the basedir.
+type transactionStep struct {
+	name string
+	// movedAside is true if the file present before has been moved to the
+	// old directory of the stage.
+	movedAside bool
+	// placed is true if the staged file has been moved in place.
+	placed bool
+}
+
+// newTransaction creates the stage of a transaction for the directory passed.
+// The stage is located in the state directory, see stateDir.
+func newTransaction(basedir string) (*transaction, error) {
+	root := filepath.Join(basedir, stateDir)
+	err := os.MkdirAll(root, 0755)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(root, stagePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{basedir: basedir, dir: dir}, nil
+}
+
+// write stages the file passed, if link is true the file is staged as symbolic
+// link pointing to data. Files which already have the content passed are not
+// staged. The permissions of files replaced are kept.
+func (t *transaction) write(name string, data []byte, link bool) error {
+	target := filepath.Join(t.basedir, name)
+	info, err := os.Lstat(target)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	isLink := exists && info.Mode()&os.ModeSymlink != 0
+
+	if exists && link && isLink {
+		current, err := os.Readlink(target)
+		if err == nil && current == string(data) {
+			return nil
+		}
+	} else if exists && !link && info.Mode().IsRegular() {
+		current, err := ioutil.ReadFile(target)
+		if err == nil && bytes.Equal(current, data) {
+			return nil
+		}
+	}
+
+	staged := filepath.Join(t.dir, stageNewDir, name)
+	err = os.MkdirAll(filepath.Dir(staged), 0755)
+	if err != nil {
+		return err
+	}
+	if link {
+		err = os.Symlink(string(data), staged)
+	} else {
+		err = ioutil.WriteFile(staged, data, 0666)
+		if err == nil && exists && info.Mode().IsRegular() {
+			err = os.Chmod(staged, info.Mode().Perm())
+		}
+	}
+	if err != nil {
+		return err
+	}
+	t.writes = append(t.writes, name)
+	return nil
+}
+
+// delete marks the file passed for deletion.
+func (t *transaction) delete(name string) {
+	t.deletes = append(t.deletes, name)
+}
+
+// commit deletes the files marked for deletion and moves all staged files in
+// place. Every file that cannot be deleted is reported. If anything fails all
+// changes are rolled back.
+func (t *transaction) commit() error {
+	sort.Strings(t.writes)
+	sort.Strings(t.deletes)
+
+	failed := []string{}
+	for _, name := range t.deletes {
+		err := t.moveAside(name)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("'%s': %s", name, err.Error()))
+		}
+	}
+	if len(failed) > 0 {
+		return t.rollback(fmt.Errorf("failed deleting files, errors are: %s", strings.Join(failed, ", ")))
+	}
+
+	for _, name := range t.writes {
+		err := t.place(name)
+		if err != nil {
+			return t.rollback(fmt.Errorf("failed writing file '%s', error is: %s", name, err.Error()))
+		}
+	}
+	return nil
+}
+
+// place moves the staged file passed in place, the file present before is
+// moved aside.
+func (t *transaction) place(name string) error {
+	target := filepath.Join(t.basedir, name)
+	if _, err := os.Lstat(target); err == nil {
+		err = t.moveAside(name)
+		if err != nil {
+			return err
+		}
+	}
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(filepath.Join(t.dir, stageNewDir, name), target)
+	if err != nil {
+		return err
+	}
+	t.done = append(t.done, transactionStep{name: name, placed: true})
+	return nil
+}
+
+// moveAside moves the file passed from the basedir to the old directory of
+// the stage.
+func (t *transaction) moveAside(name string) error {
+	target := filepath.Join(t.basedir, name)
+	info, err := os.Lstat(target)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("'%s' is a directory", name)
+	}
+	old := filepath.Join(t.dir, stageOldDir, name)
+	err = os.MkdirAll(filepath.Dir(old), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(target, old)
+	if err != nil {
+		return err
+	}
+	t.done = append(t.done, transactionStep{name: name, movedAside: true})
+	return nil
+}
+
+// rollback reverts all changes applied in reverse order and returns the error
+// passed, extended by the errors occurred while rolling back.
+func (t *transaction) rollback(cause error) error {
+	failed := []string{}
+	for i := len(t.done) - 1; i >= 0; i-- {
+		step := t.done[i]
+		target := filepath.Join(t.basedir, step.name)
+		var err error
+		if step.placed {
+			err = os.Remove(target)
+		} else if step.movedAside {
+			err = os.Rename(filepath.Join(t.dir, stageOldDir, step.name), target)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("'%s': %s", step.name, err.Error()))
+		}
+	}
+	t.done = nil
+	if len(failed) > 0 {
+		t.keep = true
+		return fmt.Errorf("%s, rolling back failed as well, the stage '%s' is kept, errors are: %s", cause.Error(), t.dir, strings.Join(failed, ", "))
+	}
+	return cause
+}
+
+// close removes the stage of the transaction. The state directory is removed
+// as well if it is empty. If rolling back failed the stage is kept to allow
+// restoring the files by hand.
+func (t *transaction) close() {
+	if t.keep {
+		return
+	}
+	os.RemoveAll(t.dir)
+	os.Remove(filepath.Dir(t.dir))
+}
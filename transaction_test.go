@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateFilesTransaction(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		write       map[string][]byte
+		del         map[string][]byte
+		expected    map[string][]byte
+		errContains []string
+	}{
+		"Success": {
+			write:    map[string][]byte{"a": []byte("new a"), "sub/c": []byte("c")},
+			del:      map[string][]byte{"b": nil},
+			expected: map[string][]byte{"a": []byte("new a"), "sub/c": []byte("c"), "dir/d": []byte("d"), "run.sh": []byte("run")},
+		},
+		"WriteFails": {
+			// 'run.sh' is a file, thus 'run.sh/e' cannot be written
+			write:       map[string][]byte{"a": []byte("new a"), "run.sh/e": []byte("e")},
+			del:         map[string][]byte{"b": nil},
+			expected:    map[string][]byte{"a": []byte("a"), "b": []byte("b"), "dir/d": []byte("d"), "run.sh": []byte("run")},
+			errContains: []string{"run.sh/e"},
+		},
+		"DeletesFail": {
+			write:       map[string][]byte{"a": []byte("new a")},
+			del:         map[string][]byte{"b": nil, "dir": nil, "missing": nil},
+			expected:    map[string][]byte{"a": []byte("a"), "b": []byte("b"), "dir/d": []byte("d"), "run.sh": []byte("run")},
+			errContains: []string{"'dir'", "'missing'"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			basepath, err := ioutil.TempDir("", "omniverse")
+			if err != nil {
+				t.Fatalf("could not create temporary directory, error was: %s", err.Error())
+			}
+			defer os.RemoveAll(basepath)
+
+			initial := map[string][]byte{"a": []byte("a"), "b": []byte("b"), "dir/d": []byte("d"), "run.sh": []byte("run")}
+			for name, data := range initial {
+				path := filepath.Join(basepath, name)
+				err := os.MkdirAll(filepath.Dir(path), 0755)
+				if err == nil {
+					err = ioutil.WriteFile(path, data, 0644)
+				}
+				if err != nil {
+					t.Fatalf("could not write file '%s', error was: %s", name, err.Error())
+				}
+			}
+			err = os.Chmod(filepath.Join(basepath, "a"), 0755)
+			if err != nil {
+				t.Fatalf("could not change mode, error was: %s", err.Error())
+			}
+
+			syncer, err := NewSyncer(basepath, "")
+			if err != nil {
+				t.Fatalf("syncer for '%s' could not be created, error was: %s", basepath, err.Error())
+			}
+			err = syncer.updateFiles(test.write, nil, test.del)
+			if err != nil && len(test.errContains) == 0 {
+				t.Errorf("has unexpected error, error is: %s", err.Error())
+			} else if err == nil && len(test.errContains) > 0 {
+				t.Errorf("error expected but no error occurred")
+			}
+			for _, s := range test.errContains {
+				if err != nil && !strings.Contains(err.Error(), s) {
+					t.Errorf("error should mention %s, error is: %s", s, err.Error())
+				}
+			}
+
+			files, err := syncer.ReadFiles()
+			if err != nil {
+				t.Fatalf("could not read files, error was: %s", err.Error())
+			}
+			if !checkSameFields(files, test.expected) {
+				t.Errorf("files are not as expected: is %v, expected %v", files, test.expected)
+			}
+			for name, data := range test.expected {
+				if string(files[name]) != string(data) {
+					t.Errorf("content of file '%s' is not as expected: is %s, expected %s", name, files[name], data)
+				}
+			}
+
+			info, err := os.Stat(filepath.Join(basepath, "a"))
+			if err != nil {
+				t.Fatalf("could not stat file, error was: %s", err.Error())
+			}
+			if info.Mode().Perm() != 0755 {
+				t.Errorf("mode of file 'a' is not as expected: is %04o, expected %04o", info.Mode().Perm(), 0755)
+			}
+			if _, err := os.Stat(filepath.Join(basepath, stateDir)); !os.IsNotExist(err) {
+				t.Errorf("stage has not been removed")
+			}
+		})
+	}
+}